@@ -0,0 +1,878 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// analyzePod is the pod whose CPU usage is broken down by container, set by --pod
+var analyzePod string
+
+// analyzeResource is the resource whose usage is reported: cpu, gpu, memory, network, storage or throttling
+var analyzeResource string
+
+// cpuUtilization compares the CPU usage of a namespace with the CPU its containers request
+type cpuUtilization struct {
+	Usage          float64  `json:"usage"`          // Cores in use
+	Requests       float64  `json:"requests"`       // Cores requested
+	UtilizationPct *float64 `json:"utilizationPct"` // Usage as a percentage of requests, nil when no requests are set
+	// OverProvisioned is set when usage is below --fail-over-ratio of the requests
+	OverProvisioned bool `json:"overProvisioned,omitempty"`
+}
+
+// quotaUsage is the utilization of one resource of a ResourceQuota
+type quotaUsage struct {
+	Namespace     string   `json:"namespace"`
+	ResourceQuota string   `json:"resourceQuota"`
+	Resource      string   `json:"resource"`
+	Used          float64  `json:"used"`
+	Hard          float64  `json:"hard"`
+	UsedPct       *float64 `json:"usedPct"` // Used as a percentage of hard, nil when hard is zero
+}
+
+// workloadCPUUsage is the CPU usage of the pods of a workload
+type workloadCPUUsage struct {
+	Namespace string  `json:"namespace"`
+	Kind      string  `json:"kind"` // Deployment, StatefulSet, DaemonSet, Job, ... or Pod for pods without an owner
+	Name      string  `json:"name"`
+	Usage     float64 `json:"usage"` // Cores in use
+}
+
+// containerCPUUsage is the CPU usage of a container of a pod
+type containerCPUUsage struct {
+	Container string  `json:"container"`
+	Usage     float64 `json:"usage"` // Cores in use
+}
+
+// analysis is the output of the analyze command for a namespace
+type analysis struct {
+	Namespace string `json:"namespace"`
+	// EvaluatedAt is the instant all the queries of the run were evaluated at, unset with --since
+	EvaluatedAt string          `json:"evaluatedAt,omitempty"`
+	CPU         *cpuUtilization `json:"cpu"`
+	GPU         *gpuUsage       `json:"gpu,omitempty"`     // Only set with --resource gpu
+	Window      *cpuWindowUsage `json:"window,omitempty"`  // Only set with --since
+	Network     *networkUsage   `json:"network,omitempty"` // Only set with --resource network
+	Storage     []pvcUsage      `json:"storage,omitempty"` // Only set with --resource storage
+	// MemoryWorkingSet is the memory working set of the namespace in bytes with --resource memory
+	MemoryWorkingSet *float64 `json:"memoryWorkingSet,omitempty"`
+	// Memory compares the working set of the containers with their memory limits with --resource memory
+	Memory []containerMemoryUsage `json:"memory,omitempty"`
+	// Throttling is how often CPU limits throttle the pods with --resource throttling
+	Throttling []podThrottling `json:"throttling,omitempty"`
+	// Containers breaks down the CPU usage of the pod given with --pod
+	Containers []containerCPUUsage `json:"containers,omitempty"`
+	// Images breaks down the CPU usage by container image with --by-image
+	Images    []imageCPUUsage    `json:"images,omitempty"`
+	Workloads []workloadCPUUsage `json:"workloads"`
+	Quotas    []quotaUsage       `json:"quotas"`
+}
+
+// analyzeCmd represents the analyze command
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Analyze resource usage and quotas",
+	Long: `Analyze compares the actual CPU usage of a namespace with the CPU requested by its
+containers, which helps spotting over-provisioned namespaces, breaks the usage down by
+workload, and reports how much of each ResourceQuota in the namespace is used.
+
+With --missing-requests it instead lists the containers of running pods that have no CPU
+request, which the scheduler cannot account for.
+
+With --resource gpu it compares the NVIDIA GPUs requested by the namespace with the GPUs
+its pods use and their utilization as reported by DCGM exporter, instead of CPU. With
+--resource network it reports the bytes per second received and transmitted by its pods,
+and with --resource storage how full its PersistentVolumeClaims are, flagging those above
+--pvc-full-threshold. With --resource memory it compares the memory working set of its
+containers with their memory limits, flagging those above --oom-threshold as at risk of
+being OOM killed and listing the containers without a limit as unbounded. With --resource
+throttling it reports the fraction of CPU periods in which the CPU limits of its pods
+throttled them, which usage alone doesn't reveal, flagging those above --throttle-threshold.
+
+With -o prometheus the findings are printed in the Prometheus text exposition format, e.g.
+to be collected by the node exporter textfile collector after a scheduled run. With -o csv
+the CPU usage of the namespaces and their workloads is printed as CSV for spreadsheets.
+
+With --since, and optionally --until, it reports the peak and average CPU usage over that
+window instead, e.g. for post-incident analysis. Both take an RFC3339 timestamp or a time
+relative to now such as -6h.
+
+With --pod the CPU usage of every container of that pod is also listed, e.g. to right-size
+a sidecar separately from the application container.
+
+With --source metrics-server the current usage is read from the metrics.k8s.io API instead
+of Prometheus, for clusters without it. Only the CPU usage and requests of the namespace, or
+its memory working set with --resource memory, are reported then. analyze is the only
+command that supports --source, the others always query Prometheus.`,
+	Example: `  k analyze -n team-a
+  k analyze -A --fail-over-ratio 0.2
+  k analyze -n team-a --since 2024-05-01T10:00:00Z --until 2024-05-01T12:00:00Z
+  k analyze -n team-a --since -6h`,
+	Annotations: map[string]string{prometheusOutputAnnotation: "", csvOutputAnnotation: ""},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		switch analyzeResource {
+		case "cpu", "gpu", "memory", "network", "storage", "throttling":
+		default:
+			return fmt.Errorf("invalid resource %q: must be one of cpu, gpu, memory, network, storage, throttling", analyzeResource)
+		}
+		if err := validateOOMThreshold(); err != nil {
+			return err
+		}
+		if err := validateThrottleThreshold(); err != nil {
+			return err
+		}
+		if analyzeResource != "cpu" && outputFormat == "csv" {
+			return fmt.Errorf("output format csv is not supported with --resource %s", analyzeResource)
+		}
+		if analyzePod != "" {
+			namespaces, _ := cmd.Flags().GetStringSlice("namespace")
+			allNamespaces, _ := cmd.Flags().GetBool("all-namespaces")
+			if len(uniqueStrings(namespaces)) > 1 || allNamespaces || cmd.Flags().Changed("namespace-file") {
+				return fmt.Errorf("--pod requires a single namespace")
+			}
+			if analyzeResource != "cpu" {
+				return fmt.Errorf("--pod can't be combined with --resource %s", analyzeResource)
+			}
+		}
+		if analyzeByImage {
+			if analyzeResource != "cpu" {
+				return fmt.Errorf("--by-image can't be combined with --resource %s", analyzeResource)
+			}
+			if outputFormat == "csv" {
+				return fmt.Errorf("output format csv is not supported with --by-image")
+			}
+		}
+		if stripRegistry && !analyzeByImage {
+			return fmt.Errorf("--strip-registry requires --by-image")
+		}
+		if err := validateSource(); err != nil {
+			return err
+		}
+		if err := validateAggregation(); err != nil {
+			return err
+		}
+		if err := validateWatch(); err != nil {
+			return err
+		}
+		if err := validateSort("name", "usage", "utilization"); err != nil {
+			return err
+		}
+		if err := validateLimit(); err != nil {
+			return err
+		}
+		if useMetricsServer() {
+			if analyzeResource != "cpu" && analyzeResource != "memory" {
+				return fmt.Errorf("--source metrics-server can't be combined with --resource %s", analyzeResource)
+			}
+			if analyzePod != "" || analyzeByImage || missingRequests || analyzeSince != "" {
+				return fmt.Errorf("--source metrics-server can't be combined with --pod, --by-image, --missing-requests or --since")
+			}
+			if aggregation != "sum" {
+				return fmt.Errorf("--source metrics-server only supports --aggregation sum")
+			}
+			if evaluationOffset != 0 {
+				return fmt.Errorf("--source metrics-server only reports current usage and can't be combined with --eval-offset")
+			}
+		}
+		if err := parseAnalysisWindow(evaluationNow()); err != nil {
+			return err
+		}
+		if !windowStart.IsZero() {
+			if analyzeResource != "cpu" || missingRequests || analyzeByImage {
+				return fmt.Errorf("--since can't be combined with --resource %s, --missing-requests or --by-image", analyzeResource)
+			}
+			if outputFormat == "prometheus" || outputFormat == "csv" {
+				return fmt.Errorf("output format %s is not supported with --since", outputFormat)
+			}
+		}
+		if err := validateFailOverRatio(); err != nil {
+			return err
+		}
+		if err := validateConcurrency(); err != nil {
+			return err
+		}
+		return validateRateWindow()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespaces, err := namespacesFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if err := startSource(); err != nil {
+			return err
+		}
+		if err := validateNamespacesExist(cmd, namespaces); err != nil {
+			return err
+		}
+
+		if missingRequests {
+			if outputFormat == "prometheus" || outputFormat == "csv" {
+				return fmt.Errorf("output format %s is not supported with --missing-requests", outputFormat)
+			}
+			return runMissingRequests(cmd.Context(), namespaces)
+		}
+		if !windowStart.IsZero() {
+			if err := confirmExpensiveQuery(namespaces, windowEnd.Sub(windowStart), windowStep()); err != nil {
+				return err
+			}
+		}
+
+		if watchMode {
+			return runWatch(cmd.Context(), func() error {
+				return runAnalysis(cmd.Context(), namespaces)
+			})
+		}
+		return runAnalysis(cmd.Context(), namespaces)
+	},
+}
+
+// runAnalysis analyzes the namespaces and prints the report
+func runAnalysis(ctx context.Context, namespaces []string) error {
+	// Namespaces that failed are reported after the results of the others
+	results, namespaceErr := runPerNamespace(namespaces, func(namespace string) (analysis, error) {
+		return analyzeNamespace(ctx, namespace)
+	})
+	if len(results) == 0 && namespaceErr != nil {
+		return namespaceErr
+	}
+	sortAnalyses(results)
+
+	// A single namespace is rendered as an object to keep the output of single-namespace runs unchanged
+	if outputFormat == "prometheus" {
+		printAnalysisMetrics(results)
+	} else if outputFormat == "csv" {
+		if err := printAnalysisCSV(results); err != nil {
+			return err
+		}
+	} else if outputFormat == "json" {
+		var err error
+		if len(namespaces) == 1 {
+			err = printJSON(results[0])
+		} else {
+			err = printJSON(results)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		if windowStart.IsZero() {
+			fmt.Printf("Evaluated at %s\n\n", evaluationNow().Format(time.RFC3339))
+		}
+		for i, result := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			if outputFormat == "table" {
+				printAnalysisTable(result)
+			} else {
+				printAnalysis(result)
+			}
+		}
+	}
+
+	warnNearlyFullPVCs(results)
+	warnOOMRisk(results)
+	warnThrottledPods(results)
+
+	var overProvisioned []string
+	for _, result := range results {
+		if result.CPU != nil && result.CPU.OverProvisioned {
+			overProvisioned = append(overProvisioned, describeNamespace(result.Namespace))
+		}
+	}
+	if err := overProvisionedError(overProvisioned); namespaceErr == nil {
+		return err
+	}
+	return namespaceErr
+}
+
+// analyzeNamespace compares usage with requests and quotas for a namespace, or for the whole cluster if it is empty
+func analyzeNamespace(ctx context.Context, namespace string) (analysis, error) {
+	result := analysis{Namespace: namespace}
+
+	if !windowStart.IsZero() {
+		window, err := queryCPUWindowUsage(ctx, namespace)
+		if err != nil {
+			return result, fmt.Errorf("querying CPU usage of %s %s: %w", describeNamespace(namespace), describeWindow(), err)
+		}
+		result.Window = window
+		return result, nil
+	}
+	result.EvaluatedAt = evaluationNow().Format(time.RFC3339)
+
+	if analyzeResource == "gpu" {
+		gpu, err := queryGPUUsage(ctx, namespace)
+		if err != nil {
+			return result, fmt.Errorf("querying GPU usage of %s: %w", describeNamespace(namespace), err)
+		}
+		result.GPU = gpu
+		return result, addQuotaUsage(ctx, &result)
+	}
+	if analyzeResource == "network" {
+		network, err := queryNetworkUsage(ctx, namespace)
+		if err != nil {
+			return result, fmt.Errorf("querying network usage of %s: %w", describeNamespace(namespace), err)
+		}
+		result.Network = network
+		return result, addQuotaUsage(ctx, &result)
+	}
+	if analyzeResource == "storage" {
+		storage, err := queryPVCUsage(ctx, namespace)
+		if err != nil {
+			return result, fmt.Errorf("querying storage usage of %s: %w", describeNamespace(namespace), err)
+		}
+		result.Storage = storage
+		return result, addQuotaUsage(ctx, &result)
+	}
+	if analyzeResource == "memory" {
+		workingSet, err := usageSource.memoryUsageForNamespace(ctx, namespace)
+		if err != nil && !errors.Is(err, errNoData) {
+			return result, fmt.Errorf("querying memory usage of %s: %w", describeNamespace(namespace), err)
+		}
+		if err == nil {
+			result.MemoryWorkingSet = &workingSet
+		}
+		// Memory limits and quotas are only known to Prometheus
+		if useMetricsServer() {
+			return result, nil
+		}
+		memory, err := queryMemoryUsage(ctx, namespace)
+		if err != nil {
+			return result, fmt.Errorf("querying memory usage of %s: %w", describeNamespace(namespace), err)
+		}
+		result.Memory = memory
+		return result, addQuotaUsage(ctx, &result)
+	}
+	if analyzeResource == "throttling" {
+		throttling, err := queryCPUThrottling(ctx, namespace)
+		if err != nil {
+			return result, fmt.Errorf("querying CPU throttling of %s: %w", describeNamespace(namespace), err)
+		}
+		result.Throttling = throttling
+		return result, addQuotaUsage(ctx, &result)
+	}
+
+	// Without usage data there is nothing to compare the requests with
+	usage, err := usageSource.cpuUsageForNamespace(ctx, namespace)
+	if err != nil && !errors.Is(err, errNoData) {
+		return result, fmt.Errorf("querying CPU usage of %s: %w", describeNamespace(namespace), err)
+	}
+	if err == nil {
+		if !useMetricsServer() {
+			checkUsageStaleness(ctx, namespace)
+		}
+		requests, err := usageSource.cpuRequestsForNamespace(ctx, namespace)
+		if err != nil {
+			return result, fmt.Errorf("querying CPU requests of %s: %w", describeNamespace(namespace), err)
+		}
+		utilization := computeCPUUtilization(usage, requests)
+		utilization.OverProvisioned = failOverRatio > 0 && evaluateThreshold(usage, requests, failOverRatio)
+		result.CPU = &utilization
+	}
+
+	// Workloads, images and quotas are only known to Prometheus
+	if useMetricsServer() {
+		return result, nil
+	}
+
+	workloads, err := queryWorkloadCPUUsage(ctx, namespace)
+	if err != nil {
+		return result, fmt.Errorf("querying workload CPU usage of %s: %w", describeNamespace(namespace), err)
+	}
+	result.Workloads = workloads
+
+	if analyzePod != "" {
+		containers, err := queryContainerCPUUsage(ctx, namespace, analyzePod)
+		if err != nil {
+			return result, fmt.Errorf("querying container CPU usage of pod %s: %w", analyzePod, err)
+		}
+		result.Containers = containers
+	}
+
+	if analyzeByImage {
+		images, err := queryImageCPUUsage(ctx, namespace)
+		if err != nil {
+			return result, fmt.Errorf("querying CPU usage by image of %s: %w", describeNamespace(namespace), err)
+		}
+		result.Images = images
+	}
+
+	return result, addQuotaUsage(ctx, &result)
+}
+
+// sortAnalyses orders the namespaces and the breakdowns of each of them by --sort
+func sortAnalyses(results []analysis) {
+	sortRows(results,
+		func(a analysis) string { return a.Namespace },
+		func(a analysis) *float64 {
+			if a.CPU == nil {
+				return nil
+			}
+			return &a.CPU.Usage
+		},
+		func(a analysis) *float64 {
+			if a.CPU == nil {
+				return nil
+			}
+			return a.CPU.UtilizationPct
+		},
+	)
+	for _, result := range results {
+		sortRows(result.Workloads,
+			func(w workloadCPUUsage) string { return workloadDisplayName(result.Namespace, w) },
+			func(w workloadCPUUsage) *float64 { return &w.Usage },
+			nil,
+		)
+		sortRows(result.Containers,
+			func(c containerCPUUsage) string { return c.Container },
+			func(c containerCPUUsage) *float64 { return &c.Usage },
+			nil,
+		)
+		sortRows(result.Images,
+			func(i imageCPUUsage) string { return i.Image },
+			func(i imageCPUUsage) *float64 { return &i.Usage },
+			nil,
+		)
+		sortRows(result.Memory,
+			func(c containerMemoryUsage) string { return containerMemoryDisplayName(result.Namespace, c) },
+			func(c containerMemoryUsage) *float64 { return &c.WorkingSet },
+			func(c containerMemoryUsage) *float64 { return c.LimitRatio },
+		)
+		sortRows(result.Throttling,
+			func(p podThrottling) string { return podThrottlingDisplayName(result.Namespace, p) },
+			func(p podThrottling) *float64 { return p.ThrottledRatio },
+			nil,
+		)
+	}
+}
+
+// addQuotaUsage adds the usage of the ResourceQuotas of the namespace to its analysis
+func addQuotaUsage(ctx context.Context, result *analysis) error {
+	quotas, err := queryQuotaUsage(ctx, result.Namespace)
+	if err != nil {
+		return fmt.Errorf("querying resource quotas of %s: %w", describeNamespace(result.Namespace), err)
+	}
+	result.Quotas = quotas
+	return nil
+}
+
+// computeCPUUtilization joins usage and requests, leaving the utilization unset when nothing is requested
+func computeCPUUtilization(usage, requests float64) cpuUtilization {
+	utilization := cpuUtilization{Usage: usage, Requests: requests}
+	if requests > 0 {
+		pct := usage / requests * 100
+		utilization.UtilizationPct = &pct
+	}
+	return utilization
+}
+
+// queryContainerCPUUsage returns the CPU usage of every container of a pod, heaviest first
+func queryContainerCPUUsage(ctx context.Context, namespace, pod string) ([]containerCPUUsage, error) {
+	samples, err := queryPrometheusVector(ctx, podContainerCPUUsageQuery(namespace, pod))
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]containerCPUUsage, 0, len(samples))
+	for _, sample := range samples {
+		containers = append(containers, containerCPUUsage{Container: sample.Metric["container"], Usage: sample.Value})
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		if containers[i].Usage != containers[j].Usage {
+			return containers[i].Usage > containers[j].Usage
+		}
+		return containers[i].Container < containers[j].Container
+	})
+	return containers, nil
+}
+
+// queryWorkloadCPUUsage returns the CPU usage of every workload in the namespace, heaviest first.
+// Pods owned by a ReplicaSet are attributed to the Deployment owning the ReplicaSet, if any.
+func queryWorkloadCPUUsage(ctx context.Context, namespace string) ([]workloadCPUUsage, error) {
+	pods, err := queryPrometheusVector(ctx, podOwnerCPUUsageQuery(namespace))
+	if err != nil {
+		return nil, err
+	}
+	replicaSets, err := queryPrometheusVector(ctx, replicaSetOwnerQuery(namespace))
+	if err != nil {
+		return nil, err
+	}
+
+	type workloadKey struct{ namespace, kind, name string }
+	deployments := map[workloadKey]string{}
+	for _, sample := range replicaSets {
+		if sample.Metric["owner_kind"] == "Deployment" {
+			deployments[workloadKey{sample.Metric["namespace"], "ReplicaSet", sample.Metric["replicaset"]}] = sample.Metric["owner_name"]
+		}
+	}
+
+	byKey := map[workloadKey]*workloadCPUUsage{}
+	for _, sample := range pods {
+		key := workloadKey{sample.Metric["namespace"], sample.Metric["owner_kind"], sample.Metric["owner_name"]}
+		// kube-state-metrics reports pods without an owner with the kind and name "<none>"
+		if key.kind == "<none>" || key.kind == "" {
+			key.kind, key.name = "Pod", sample.Metric["pod"]
+		}
+		if deployment, ok := deployments[key]; ok {
+			key.kind, key.name = "Deployment", deployment
+		}
+		usage, ok := byKey[key]
+		if !ok {
+			usage = &workloadCPUUsage{Namespace: key.namespace, Kind: key.kind, Name: key.name}
+			byKey[key] = usage
+		}
+		usage.Usage += sample.Value
+	}
+
+	workloads := make([]workloadCPUUsage, 0, len(byKey))
+	for _, usage := range byKey {
+		workloads = append(workloads, *usage)
+	}
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].Usage != workloads[j].Usage {
+			return workloads[i].Usage > workloads[j].Usage
+		}
+		return workloadDisplayName("", workloads[i]) < workloadDisplayName("", workloads[j])
+	})
+	return workloads, nil
+}
+
+// workloadDisplayName returns the kind and name of a workload, qualified with its namespace when reporting on all namespaces
+func workloadDisplayName(namespace string, workload workloadCPUUsage) string {
+	if namespace == "" {
+		return workload.Namespace + "/" + workload.Kind + "/" + workload.Name
+	}
+	return workload.Kind + "/" + workload.Name
+}
+
+// queryQuotaUsage returns the utilization of every resource of every ResourceQuota in the namespace.
+// Quotas are listed per ResourceQuota object rather than summed, ordered by namespace, quota and resource name.
+func queryQuotaUsage(ctx context.Context, namespace string) ([]quotaUsage, error) {
+	samples, err := queryPrometheusVector(ctx, namespaceQuotaQuery(namespace))
+	if err != nil {
+		return nil, err
+	}
+
+	type quotaKey struct{ namespace, quota, resource string }
+	byKey := map[quotaKey]*quotaUsage{}
+	var keys []quotaKey
+	for _, sample := range samples {
+		key := quotaKey{
+			namespace: sample.Metric["namespace"],
+			quota:     sample.Metric["resourcequota"],
+			resource:  sample.Metric["resource"],
+		}
+		usage, ok := byKey[key]
+		if !ok {
+			usage = &quotaUsage{Namespace: key.namespace, ResourceQuota: key.quota, Resource: key.resource}
+			byKey[key] = usage
+			keys = append(keys, key)
+		}
+		switch sample.Metric["type"] {
+		case "used":
+			usage.Used = sample.Value
+		case "hard":
+			usage.Hard = sample.Value
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].namespace != keys[j].namespace {
+			return keys[i].namespace < keys[j].namespace
+		}
+		if keys[i].quota != keys[j].quota {
+			return keys[i].quota < keys[j].quota
+		}
+		return keys[i].resource < keys[j].resource
+	})
+
+	quotas := make([]quotaUsage, 0, len(keys))
+	for _, key := range keys {
+		usage := byKey[key]
+		if usage.Hard > 0 {
+			pct := usage.Used / usage.Hard * 100
+			usage.UsedPct = &pct
+		}
+		quotas = append(quotas, *usage)
+	}
+	return quotas, nil
+}
+
+// printAnalysis prints the analysis of a namespace in text format
+func printAnalysis(result analysis) {
+	fmt.Printf("Analysis for %s:\n", describeNamespace(result.Namespace))
+	if !windowStart.IsZero() {
+		if result.Window == nil {
+			fmt.Printf("  No CPU usage data found for %s %s\n", describeNamespace(result.Namespace), describeWindow())
+			return
+		}
+		fmt.Printf("  CPU usage %s:\n", describeWindow())
+		fmt.Printf("    Peak:    %s\n", formatCPU(result.Window.Max))
+		fmt.Printf("    Average: %s\n", formatCPU(result.Window.Avg))
+		return
+	}
+	if analyzeResource == "gpu" {
+		printGPUUsage(result.Namespace, result.GPU)
+	} else if analyzeResource == "network" {
+		printNetworkUsage(result.Namespace, result.Network)
+	} else if analyzeResource == "storage" {
+		printPVCUsage(result.Namespace, result.Storage)
+	} else if analyzeResource == "memory" {
+		printMemoryUsage(result.Namespace, result.MemoryWorkingSet, result.Memory)
+	} else if analyzeResource == "throttling" {
+		printCPUThrottling(result.Namespace, result.Throttling)
+	} else if result.CPU == nil {
+		fmt.Printf("  No CPU usage data found for %s (no running pods or metric unavailable)\n", describeNamespace(result.Namespace))
+	} else {
+		fmt.Printf("  CPU usage:       %s\n", formatCPU(result.CPU.Usage))
+		if result.CPU.UtilizationPct == nil {
+			fmt.Println("  CPU requests:    unset")
+			fmt.Println("  CPU utilization: unset")
+		} else {
+			fmt.Printf("  CPU requests:    %s\n", formatCPU(result.CPU.Requests))
+			fmt.Printf("  CPU utilization: %.*f%%\n", decimals(1), *result.CPU.UtilizationPct)
+		}
+	}
+
+	if len(result.Workloads) > 0 {
+		fmt.Println("  CPU usage by workload:")
+		workloads, more := limitRows(result.Workloads)
+		for _, workload := range workloads {
+			fmt.Printf("    %s: %s\n", workloadDisplayName(result.Namespace, workload), formatCPU(workload.Usage))
+		}
+		printMoreRows("    ", more)
+	}
+
+	if analyzePod != "" {
+		if len(result.Containers) == 0 {
+			fmt.Printf("  No CPU usage data found for pod %s\n", analyzePod)
+		} else {
+			fmt.Printf("  CPU usage by container of pod %s:\n", analyzePod)
+			containers, more := limitRows(result.Containers)
+			for _, container := range containers {
+				fmt.Printf("    %s: %s\n", container.Container, formatCPU(container.Usage))
+			}
+			printMoreRows("    ", more)
+		}
+	}
+
+	if analyzeByImage {
+		printImageCPUUsage(result.Images)
+	}
+
+	if len(result.Quotas) == 0 {
+		if !useMetricsServer() {
+			fmt.Println("  No resource quotas found")
+		}
+		return
+	}
+	fmt.Println("  Resource quotas:")
+	currentQuota := ""
+	for _, quota := range result.Quotas {
+		if name := quotaDisplayName(result.Namespace, quota); name != currentQuota {
+			currentQuota = name
+			fmt.Printf("    %s:\n", currentQuota)
+		}
+		used := formatQuotaValue(quota.Resource, quota.Used)
+		hard := formatQuotaValue(quota.Resource, quota.Hard)
+		if quota.UsedPct == nil {
+			fmt.Printf("      %s: %s/%s\n", quota.Resource, used, hard)
+		} else {
+			fmt.Printf("      %s: %s/%s (%.*f%%)\n", quota.Resource, used, hard, decimals(1), *quota.UsedPct)
+		}
+	}
+}
+
+// printAnalysisTable prints the analysis of a namespace as aligned tables
+func printAnalysisTable(result analysis) {
+	fmt.Printf("Analysis for %s:\n\n", describeNamespace(result.Namespace))
+
+	var rows [][]string
+	if analyzeResource == "storage" {
+		printPVCUsageTable(result.Namespace, result.Storage)
+		printQuotaUsageTable(result)
+		return
+	}
+	if analyzeResource == "memory" {
+		printMemoryUsageTable(result.Namespace, result.MemoryWorkingSet, result.Memory)
+		printQuotaUsageTable(result)
+		return
+	}
+	if analyzeResource == "throttling" {
+		printCPUThrottlingTable(result.Namespace, result.Throttling)
+		printQuotaUsageTable(result)
+		return
+	}
+	if !windowStart.IsZero() {
+		if result.Window == nil {
+			rows = append(rows, []string{"CPU usage", "no data", ""})
+		} else {
+			rows = append(rows,
+				[]string{"Peak CPU usage", formatCPU(result.Window.Max), "cores"},
+				[]string{"Average CPU usage", formatCPU(result.Window.Avg), "cores"},
+			)
+		}
+		fmt.Printf("CPU usage %s\n", describeWindow())
+		fmt.Print(renderTable([]string{"METRIC", "VALUE", "UNIT"}, rows))
+		return
+	}
+	if analyzeResource == "gpu" {
+		rows = gpuUsageRows(result.GPU)
+	} else if analyzeResource == "network" {
+		rows = networkUsageRows(result.Network)
+	} else if result.CPU == nil {
+		rows = append(rows, []string{"CPU usage", "no data", ""})
+	} else {
+		rows = append(rows, []string{"CPU usage", formatCPU(result.CPU.Usage), "cores"})
+		if result.CPU.UtilizationPct == nil {
+			rows = append(rows, []string{"CPU requests", "unset", ""}, []string{"CPU utilization", "unset", ""})
+		} else {
+			utilization := fmt.Sprintf("%.*f", decimals(1), *result.CPU.UtilizationPct)
+			// Utilization is only judged against --fail-over-ratio
+			if failOverRatio > 0 {
+				utilization = colorizeStatus(utilization, result.CPU.OverProvisioned)
+			}
+			rows = append(rows,
+				[]string{"CPU requests", formatCPU(result.CPU.Requests), "cores"},
+				[]string{"CPU utilization", utilization, "%"},
+			)
+		}
+	}
+	fmt.Print(renderTable([]string{"METRIC", "VALUE", "UNIT"}, rows))
+
+	if len(result.Workloads) > 0 {
+		rows = nil
+		workloads, more := limitRows(result.Workloads)
+		for _, workload := range workloads {
+			rows = append(rows, []string{workloadDisplayName(result.Namespace, workload), formatCPU(workload.Usage)})
+		}
+		fmt.Println()
+		fmt.Print(renderTable([]string{"WORKLOAD", "CPU"}, rows))
+		printMoreRows("", more)
+	}
+
+	if len(result.Containers) > 0 {
+		rows = nil
+		containers, more := limitRows(result.Containers)
+		for _, container := range containers {
+			rows = append(rows, []string{container.Container, formatCPU(container.Usage)})
+		}
+		fmt.Printf("\nContainers of pod %s:\n", analyzePod)
+		fmt.Print(renderTable([]string{"CONTAINER", "CPU"}, rows))
+		printMoreRows("", more)
+	}
+
+	if len(result.Images) > 0 {
+		images, more := limitRows(result.Images)
+		fmt.Println()
+		fmt.Print(renderTable([]string{"IMAGE", "CPU"}, imageCPUUsageRows(images)))
+		printMoreRows("", more)
+	}
+
+	printQuotaUsageTable(result)
+}
+
+// printQuotaUsageTable prints the usage of the resource quotas of a namespace as an aligned table, if it has any
+func printQuotaUsageTable(result analysis) {
+	if len(result.Quotas) == 0 {
+		return
+	}
+	var rows [][]string
+	for _, quota := range result.Quotas {
+		usedPct := "-"
+		if quota.UsedPct != nil {
+			usedPct = fmt.Sprintf("%.*f%%", decimals(1), *quota.UsedPct)
+		}
+		rows = append(rows, []string{
+			quotaDisplayName(result.Namespace, quota),
+			quota.Resource,
+			formatQuotaValue(quota.Resource, quota.Used),
+			formatQuotaValue(quota.Resource, quota.Hard),
+			usedPct,
+		})
+	}
+	fmt.Println()
+	fmt.Print(renderTable([]string{"QUOTA", "RESOURCE", "USED", "HARD", "USED%"}, rows))
+}
+
+// printAnalysisCSV prints the CPU usage of the namespaces and of their workloads as CSV, one row per namespace
+// followed by one row per workload. Workloads have no request or utilization columns since only their usage is known.
+func printAnalysisCSV(results []analysis) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"namespace", "workload", "cpu_usage", "cpu_request", "utilization_pct"})
+	for _, result := range results {
+		namespace := result.Namespace
+		if namespace == "" {
+			namespace = "*"
+		}
+		if result.CPU != nil {
+			utilization := ""
+			if result.CPU.UtilizationPct != nil {
+				utilization = strconv.FormatFloat(*result.CPU.UtilizationPct, 'f', decimals(1), 64)
+			}
+			w.Write([]string{namespace, "", formatCSVCores(result.CPU.Usage), formatCSVCores(result.CPU.Requests), utilization})
+		}
+		for _, workload := range result.Workloads {
+			w.Write([]string{workload.Namespace, workload.Kind + "/" + workload.Name, formatCSVCores(workload.Usage), "", ""})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// formatCSVCores formats cores with a fixed number of decimals, three unless --precision is set, so that
+// spreadsheets read every value the same way
+func formatCSVCores(cores float64) string {
+	return strconv.FormatFloat(cores, 'f', decimals(3), 64)
+}
+
+// quotaDisplayName returns the name of a quota, qualified with its namespace when reporting on all namespaces
+func quotaDisplayName(namespace string, quota quotaUsage) string {
+	if namespace == "" {
+		return quota.Namespace + "/" + quota.ResourceQuota
+	}
+	return quota.ResourceQuota
+}
+
+// formatQuotaValue formats a quota value in the units of its resource
+func formatQuotaValue(resource string, value float64) string {
+	switch {
+	case strings.HasSuffix(resource, "cpu"):
+		return formatCPU(value)
+	case strings.HasSuffix(resource, "memory") || strings.HasSuffix(resource, "storage"):
+		return formatMemory(value)
+	}
+	return fmt.Sprintf("%g", value)
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+
+	addNamespaceFlags(analyzeCmd)
+	addFailOverRatioFlag(analyzeCmd)
+	addRateWindowFlag(analyzeCmd)
+	addAggregationFlag(analyzeCmd)
+	addWatchFlags(analyzeCmd)
+	addSortFlags(analyzeCmd, "name", "usage", "utilization")
+	addLimitFlag(analyzeCmd)
+	addConcurrencyFlag(analyzeCmd)
+	addPVCFullThresholdFlag(analyzeCmd)
+	addOOMThresholdFlag(analyzeCmd)
+	addThrottleThresholdFlag(analyzeCmd)
+	analyzeCmd.Flags().BoolVar(&analyzeByImage, "by-image", false, "Also break down the CPU usage by container image")
+	analyzeCmd.Flags().BoolVar(&stripRegistry, "strip-registry", false, "Drop the registry host from image names with --by-image, adding up the same image pulled from different registries")
+	analyzeCmd.Flags().StringVarP(&analyzePod, "pod", "p", "", "Also break down the CPU usage of this pod by container")
+	analyzeCmd.Flags().StringVar(&analyzeSince, "since", "", "Report the peak and average CPU usage from this time, an RFC3339 timestamp or relative to now such as -6h")
+	analyzeCmd.Flags().StringVar(&analyzeUntil, "until", "", "End of the --since window, an RFC3339 timestamp or relative to now (default is now)")
+	analyzeCmd.Flags().StringVar(&analyzeResource, "resource", "cpu", "Resource to analyze: cpu, gpu for NVIDIA GPUs reported by DCGM exporter, memory, network, storage or throttling")
+	analyzeCmd.Flags().StringVar(&sourceName, "source", "prometheus", "Backend to read usage from: prometheus, or metrics-server for clusters without Prometheus (current CPU usage and requests, or memory working set, only)")
+	analyzeCmd.Flags().BoolVar(&missingRequests, "missing-requests", false, "List the containers of running pods that have no CPU request instead of analyzing usage")
+}
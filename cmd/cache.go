@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+)
+
+// cacheTTL is how long Prometheus responses are reused for identical queries, 0 disables caching
+var cacheTTL time.Duration
+
+// cachedResponse is a Prometheus response body kept until it expires
+type cachedResponse struct {
+	body    []byte
+	expires time.Time
+}
+
+// responseCache holds Prometheus responses by request URL. It is shared by the namespaces queried in parallel.
+var responseCache = struct {
+	sync.Mutex
+	entries map[string]cachedResponse
+}{entries: map[string]cachedResponse{}}
+
+// cachedPrometheusResponse returns the cached response for a request URL if it has not expired
+func cachedPrometheusResponse(fullURL string) ([]byte, bool) {
+	responseCache.Lock()
+	defer responseCache.Unlock()
+
+	entry, ok := responseCache.entries[fullURL]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(responseCache.entries, fullURL)
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// cachePrometheusResponse stores the response for a request URL for cacheTTL
+func cachePrometheusResponse(fullURL string, body []byte) {
+	responseCache.Lock()
+	defer responseCache.Unlock()
+
+	responseCache.entries[fullURL] = cachedResponse{body: body, expires: time.Now().Add(cacheTTL)}
+}
+
+// clearResponseCache drops all cached responses
+func clearResponseCache() {
+	responseCache.Lock()
+	defer responseCache.Unlock()
+
+	responseCache.entries = map[string]cachedResponse{}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"golang.org/x/term"
+)
+
+var (
+	colorMode    string // auto, always or never, set by --color
+	colorEnabled bool   // Whether table cells are colored, decided once stdout is known
+)
+
+// ANSI escape sequences coloring table cells
+const (
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorReset = "\033[0m"
+)
+
+// ansiEscapePattern matches the ANSI escape sequences that take no room on the terminal
+var ansiEscapePattern = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// startColor decides whether table cells are colored: with --color auto only when stdout is a terminal and NO_COLOR is
+// not set
+func startColor() error {
+	switch colorMode {
+	case "always":
+		colorEnabled = true
+	case "never":
+		colorEnabled = false
+	case "auto":
+		_, noColor := os.LookupEnv("NO_COLOR")
+		colorEnabled = !noColor && term.IsTerminal(int(os.Stdout.Fd()))
+	default:
+		return fmt.Errorf("invalid color mode %q: must be one of auto, always, never", colorMode)
+	}
+	return nil
+}
+
+// colorize wraps a table cell in a color when colors are enabled
+func colorize(cell, color string) string {
+	if !colorEnabled || cell == "" {
+		return cell
+	}
+	return color + cell + colorReset
+}
+
+// colorizeStatus colors a table cell red when a threshold is exceeded and green otherwise
+func colorizeStatus(cell string, exceeded bool) string {
+	if exceeded {
+		return colorize(cell, colorRed)
+	}
+	return colorize(cell, colorGreen)
+}
+
+// visibleWidth returns the number of characters of a cell shown on the terminal, leaving out color sequences
+func visibleWidth(cell string) int {
+	return len([]rune(ansiEscapePattern.ReplaceAllString(cell, "")))
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// exitCodeFastGrowth is the exit status when the CPU usage of a namespace grew more than --growth-threshold
+const exitCodeFastGrowth = 3
+
+var (
+	compareOffset   time.Duration // How far back the baseline usage is taken
+	growthThreshold float64       // Growth in percent above which a namespace is flagged; 0 disables the check
+)
+
+// usageComparison compares the current CPU usage of a namespace with its usage at the baseline
+type usageComparison struct {
+	Namespace string   `json:"namespace"`
+	Current   *float64 `json:"current"`   // Cores in use now, nil without data
+	Baseline  *float64 `json:"baseline"`  // Cores in use --offset ago, nil without data
+	GrowthPct *float64 `json:"growthPct"` // Change from the baseline in percent, nil when it can't be computed
+	// Growing is set when the growth is above --growth-threshold
+	Growing bool `json:"growing,omitempty"`
+}
+
+// compareCmd represents the compare command
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare the current CPU usage of namespaces with their usage a week ago",
+	Long: `Compare shows how the CPU usage of namespaces changed since a baseline, one week ago
+by default, which tells whether usage is trending up. With --growth-threshold it exits
+with status 3 when a namespace grew by more than the given percentage.`,
+	Example: `  k compare -A
+  k compare -n team-a --offset 24h --growth-threshold 20`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if compareOffset <= 0 {
+			return fmt.Errorf("invalid offset %s: must be positive", compareOffset)
+		}
+		if growthThreshold < 0 {
+			return fmt.Errorf("invalid growth threshold %g: must not be negative", growthThreshold)
+		}
+		if err := validateConcurrency(); err != nil {
+			return err
+		}
+		if err := validateAggregation(); err != nil {
+			return err
+		}
+		return validateRateWindow()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespaces, err := namespacesFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if err := validateNamespacesExist(cmd, namespaces); err != nil {
+			return err
+		}
+		baselineTime := evaluationNow().Add(-compareOffset)
+		results, namespaceErr := runPerNamespace(namespaces, func(namespace string) (usageComparison, error) {
+			return compareNamespace(cmd.Context(), namespace, baselineTime)
+		})
+		if len(results) == 0 && namespaceErr != nil {
+			return namespaceErr
+		}
+
+		switch outputFormat {
+		case "json":
+			if err := printJSON(results); err != nil {
+				return err
+			}
+		case "table":
+			printComparisonTable(results)
+		default:
+			printComparison(results)
+		}
+
+		var growing []string
+		for _, result := range results {
+			if result.Growing {
+				growing = append(growing, describeNamespace(result.Namespace))
+			}
+		}
+		if err := fastGrowthError(growing); namespaceErr == nil {
+			return err
+		}
+		return namespaceErr
+	},
+}
+
+// compareNamespace queries the CPU usage of a namespace now and at the baseline time
+func compareNamespace(ctx context.Context, namespace string, baselineTime time.Time) (usageComparison, error) {
+	result := usageComparison{Namespace: namespace}
+	query := namespaceCPUUsageQuery(namespace)
+
+	current, err := queryPrometheusValue(ctx, query)
+	if err != nil && !errors.Is(err, errNoData) {
+		return result, fmt.Errorf("querying CPU usage of %s: %w", describeNamespace(namespace), err)
+	}
+	if err == nil {
+		result.Current = &current
+	}
+
+	baseline, err := queryPrometheusValueAt(ctx, query, baselineTime)
+	if err != nil && !errors.Is(err, errNoData) {
+		return result, fmt.Errorf("querying CPU usage of %s %s ago: %w", describeNamespace(namespace), formatPrometheusDuration(compareOffset), err)
+	}
+	if err == nil {
+		result.Baseline = &baseline
+	}
+
+	if result.Current != nil && result.Baseline != nil {
+		result.GrowthPct = computeGrowth(current, baseline)
+		result.Growing = growthThreshold > 0 && result.GrowthPct != nil && *result.GrowthPct > growthThreshold
+	}
+	return result, nil
+}
+
+// computeGrowth returns the change from past to now in percent. Growth from no usage at all is undefined and nil
+// is returned, unless there is still no usage, which is no change.
+func computeGrowth(now, past float64) *float64 {
+	var pct float64
+	if past <= 0 {
+		if now > 0 {
+			return nil
+		}
+		return &pct
+	}
+	pct = (now - past) / past * 100
+	return &pct
+}
+
+// fastGrowthError reports the namespaces growing faster than the threshold on stderr and returns an error exiting
+// with exitCodeFastGrowth if there are any
+func fastGrowthError(namespaces []string) error {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	for _, namespace := range namespaces {
+		fmt.Fprintf(os.Stderr, "Growing: the CPU usage of %s grew more than %g%% in %s\n", namespace, growthThreshold, formatPrometheusDuration(compareOffset))
+	}
+	return &exitError{
+		code: exitCodeFastGrowth,
+		err:  fmt.Errorf("%d namespace(s) growing faster than the threshold", len(namespaces)),
+	}
+}
+
+// formatOptionalCPU formats CPU usage that may be missing
+func formatOptionalCPU(cores *float64) string {
+	if cores == nil {
+		return "no data"
+	}
+	return formatCPU(*cores)
+}
+
+// formatGrowth formats a change in percent with its sign
+func formatGrowth(pct *float64) string {
+	if pct == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%+.*f%%", decimals(1), *pct)
+}
+
+// printComparison prints the usage comparisons in text format
+func printComparison(results []usageComparison) {
+	offset := formatPrometheusDuration(compareOffset)
+	for i, result := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("CPU usage of %s compared with %s ago:\n", describeNamespace(result.Namespace), offset)
+		fmt.Printf("  Now:     %s\n", formatOptionalCPU(result.Current))
+		fmt.Printf("  Before:  %s\n", formatOptionalCPU(result.Baseline))
+		fmt.Printf("  Change:  %s", formatGrowth(result.GrowthPct))
+		if result.Growing {
+			fmt.Printf(" (above %g%%)", growthThreshold)
+		}
+		fmt.Println()
+	}
+}
+
+// printComparisonTable prints the usage comparisons as an aligned table with one row per namespace
+func printComparisonTable(results []usageComparison) {
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		namespace := result.Namespace
+		if namespace == "" {
+			namespace = "*"
+		}
+		status := ""
+		if result.Growing {
+			status = colorize("Growing", colorRed)
+		}
+		growth := formatGrowth(result.GrowthPct)
+		if growthThreshold > 0 && result.GrowthPct != nil {
+			growth = colorizeStatus(growth, result.Growing)
+		}
+		rows = append(rows, []string{
+			namespace,
+			formatOptionalCPU(result.Current),
+			formatOptionalCPU(result.Baseline),
+			growth,
+			status,
+		})
+	}
+	fmt.Print(renderTable([]string{"NAMESPACE", "NOW", formatPrometheusDuration(compareOffset) + " AGO", "CHANGE", "STATUS"}, rows))
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	addNamespaceFlags(compareCmd)
+	addRateWindowFlag(compareCmd)
+	addAggregationFlag(compareCmd)
+	addConcurrencyFlag(compareCmd)
+	compareCmd.Flags().DurationVar(&compareOffset, "offset", 7*24*time.Hour, "How far back to take the baseline usage")
+	compareCmd.Flags().Float64Var(&growthThreshold, "growth-threshold", 0, "Exit with status 3 when CPU usage grew by more than this percentage, e.g. 20 (default is disabled)")
+}
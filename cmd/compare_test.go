@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestComputeGrowth(t *testing.T) {
+	tests := []struct {
+		name      string
+		now, past float64
+		want      *float64
+	}{
+		{name: "growth", now: 1.5, past: 1, want: floatPtr(50.0)},
+		{name: "negative growth", now: 0.25, past: 1, want: floatPtr(-75.0)},
+		{name: "no change", now: 2, past: 2, want: floatPtr(0.0)},
+		{name: "growth from no usage is undefined", now: 1, past: 0, want: nil},
+		{name: "still no usage", now: 0, past: 0, want: floatPtr(0.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeGrowth(tt.now, tt.past)
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || math.Abs(*got-*tt.want) > 1e-9:
+				t.Errorf("computeGrowth(%g, %g) = %s, want %s", tt.now, tt.past, formatGrowth(got), formatGrowth(tt.want))
+			}
+		})
+	}
+}
+
+func TestCompareNamespaceGrowthThreshold(t *testing.T) {
+	savedThreshold, savedInstant := growthThreshold, evaluationInstant
+	t.Cleanup(func() { growthThreshold, evaluationInstant = savedThreshold, savedInstant })
+	evaluationInstant = time.Unix(1700000000, 0)
+	baselineTime := evaluationInstant.Add(-7 * 24 * time.Hour)
+
+	// Usage doubled from 1 core at the baseline to 2 cores now
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		value := "2"
+		if r.FormValue("time") == strconv.FormatInt(baselineTime.Unix(), 10) {
+			value = "1"
+		}
+		respondWith(http.StatusOK, fmt.Sprintf(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,%q]}]}}`, value))(w, r)
+	})
+
+	tests := []struct {
+		threshold   float64
+		wantGrowing bool
+	}{
+		{threshold: 0, wantGrowing: false},
+		{threshold: 50, wantGrowing: true},
+		{threshold: 100, wantGrowing: false},
+		{threshold: 150, wantGrowing: false},
+	}
+	for _, tt := range tests {
+		growthThreshold = tt.threshold
+		result, err := compareNamespace(context.Background(), "a", baselineTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.GrowthPct == nil || *result.GrowthPct != 100 {
+			t.Fatalf("growth = %s, want +100%%", formatGrowth(result.GrowthPct))
+		}
+		if result.Growing != tt.wantGrowing {
+			t.Errorf("growing with a threshold of %g%% = %t, want %t", tt.threshold, result.Growing, tt.wantGrowing)
+		}
+	}
+}
+
+func TestFastGrowthError(t *testing.T) {
+	if err := fastGrowthError(nil); err != nil {
+		t.Errorf("fastGrowthError(nil) = %v, want nil", err)
+	}
+	var err error
+	captureStderr(t, func() { err = fastGrowthError([]string{"namespace 'a'"}) })
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != exitCodeFastGrowth {
+		t.Errorf("error = %v, want an exit error with code %d", err, exitCodeFastGrowth)
+	}
+}
+
+// floatPtr returns a pointer to v
+func floatPtr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// completionCmd represents the completion command, replacing the default one of cobra to document the installation
+var completionCmd = &cobra.Command{
+	Use:   "completion <bash|zsh|fish|powershell>",
+	Short: "Generate the shell completion script",
+	Long: `Completion prints the completion script for the given shell. Besides commands and flags,
+--namespace is completed with the namespaces of the cluster of the current kube context.
+
+To load completions in the current shell:
+
+  bash:       source <(k completion bash)
+  zsh:        source <(k completion zsh)
+  fish:       k completion fish | source
+  powershell: k completion powershell | Out-String | Invoke-Expression
+
+To load them in every new shell:
+
+  bash:       k completion bash > /etc/bash_completion.d/k
+  zsh:        k completion zsh > "${fpath[1]}/_k"
+  fish:       k completion fish > ~/.config/fish/completions/k.fish
+  powershell: add the line above to your $PROFILE`,
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	// Generating the script needs no Prometheus configuration
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return rootCmd.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+		return fmt.Errorf("unsupported shell %q", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// concurrency is the maximum number of namespaces queried in parallel
+var concurrency int
+
+// addConcurrencyFlag registers the --concurrency flag on a command
+func addConcurrencyFlag(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "Maximum number of namespaces queried in parallel")
+}
+
+// validateConcurrency checks that at least one namespace can be queried at a time
+func validateConcurrency() error {
+	if concurrency < 1 {
+		return fmt.Errorf("invalid concurrency %d: must be at least 1", concurrency)
+	}
+	return nil
+}
+
+// runPerNamespace calls fn for every namespace with at most --concurrency calls in flight.
+// The results of the namespaces that succeeded are returned in the order of the namespaces, regardless of the
+// order in which the calls complete. A failing namespace does not stop the others; all errors are joined.
+func runPerNamespace[T any](namespaces []string, fn func(namespace string) (T, error)) ([]T, error) {
+	results := make([]T, len(namespaces))
+	errs := make([]error, len(namespaces))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(concurrency, len(namespaces)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i], errs[i] = fn(namespaces[i])
+			}
+		}()
+	}
+	for i := range namespaces {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	succeeded := make([]T, 0, len(namespaces))
+	for i := range namespaces {
+		if errs[i] == nil {
+			succeeded = append(succeeded, results[i])
+		}
+	}
+	return succeeded, errors.Join(errs...)
+}
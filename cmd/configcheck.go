@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// configKeyKind is the type of value expected for a config file key
+type configKeyKind int
+
+const (
+	configString configKeyKind = iota
+	configDuration
+	configInt
+	configBool
+	configStrings // A string or a list of strings
+)
+
+// configKeys are the keys the config file may contain and the type of their values
+var configKeys = map[string]configKeyKind{
+	"prometheus.url":                      configStrings,
+	"prometheus.timeout":                  configDuration,
+	"prometheus.max_retries":              configInt,
+	"prometheus.cache_ttl":                configDuration,
+	"prometheus.scrape_interval":          configDuration,
+	"prometheus.step":                     configDuration,
+	"prometheus.bearer_token":             configString,
+	"prometheus.bearer_token_file":        configString,
+	"prometheus.username":                 configString,
+	"prometheus.password":                 configString,
+	"prometheus.tenant":                   configString,
+	"prometheus.proxy_url":                configString,
+	"prometheus.tls.ca_file":              configString,
+	"prometheus.tls.cert_file":            configString,
+	"prometheus.tls.key_file":             configString,
+	"prometheus.tls.insecure_skip_verify": configBool,
+	"log.level":                           configString,
+	"log.format":                          configString,
+}
+
+// configMapSections are the config file sections whose keys are chosen by the user
+var configMapSections = []string{"prometheus.headers.", "queries."}
+
+// validateConfig checks the keys set in the config file loaded by v. Unknown keys, which are most likely misspelled,
+// are reported on w as warnings, while values of the wrong type are an error.
+func validateConfig(v *viper.Viper, w io.Writer) error {
+	keys := v.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !v.InConfig(key) {
+			continue
+		}
+		// Profiles override the same keys as the top level
+		lookup := key
+		if suffix, ok := profileKeySuffix(key); ok {
+			lookup = suffix
+		}
+		kind, known := configKeys[lookup]
+		if !known {
+			if !hasConfigMapSection(lookup) {
+				fmt.Fprintf(w, "Warning: unknown key %s in config file %s\n", key, v.ConfigFileUsed())
+			}
+			continue
+		}
+		if err := checkConfigValue(kind, v.Get(key)); err != nil {
+			return fmt.Errorf("invalid %s in config file %s: %w", key, v.ConfigFileUsed(), err)
+		}
+	}
+	return nil
+}
+
+// hasConfigMapSection reports whether key belongs to a section whose keys are chosen by the user
+func hasConfigMapSection(key string) bool {
+	for _, section := range configMapSections {
+		if strings.HasPrefix(key, section) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfigValue checks that a value read from the config file has the expected type
+func checkConfigValue(kind configKeyKind, value interface{}) error {
+	switch kind {
+	case configString:
+		// Scalars such as a numeric password are read as strings
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return fmt.Errorf("must be a string")
+		}
+	case configDuration:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a duration with a unit, e.g. 30s or 5m")
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			return fmt.Errorf("must be a duration with a unit, e.g. 30s or 5m: %w", err)
+		}
+	case configStrings:
+		switch value := value.(type) {
+		case map[string]interface{}:
+			return fmt.Errorf("must be a string or a list of strings")
+		case []interface{}:
+			for _, item := range value {
+				switch item.(type) {
+				case map[string]interface{}, []interface{}:
+					return fmt.Errorf("must be a string or a list of strings")
+				}
+			}
+		}
+	case configInt:
+		if _, ok := value.(int); !ok {
+			return fmt.Errorf("must be a whole number")
+		}
+	case configBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be true or false")
+		}
+	}
+	return nil
+}
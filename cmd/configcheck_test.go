@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// configFrom returns a viper instance that loaded the YAML config file content
+func configFrom(t *testing.T, content string) *viper.Viper {
+	t.Helper()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(content)); err != nil {
+		t.Fatalf("reading config: %v", err)
+	}
+	return v
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantWarning string
+		wantErr     string
+	}{
+		{
+			name: "valid config",
+			content: `
+prometheus:
+  url: [http://prometheus-0:9090, http://prometheus-1:9090]
+  timeout: 30s
+  max_retries: 3
+  headers:
+    X-Team: capacity
+  tls:
+    insecure_skip_verify: false
+queries:
+  cpu_recording_rule: namespace:container_cpu_usage:sum
+profiles:
+  prod:
+    prometheus:
+      url: http://prometheus.prod:9090
+log:
+  level: debug
+`,
+		},
+		{name: "unknown key", content: "prometheus:\n  timout: 30s\n", wantWarning: "Warning: unknown key prometheus.timout"},
+		{name: "unknown profile key", content: "profiles:\n  prod:\n    prometeus:\n      url: x\n", wantWarning: "Warning: unknown key profiles.prod.prometeus.url"},
+		{name: "invalid duration", content: "prometheus:\n  timeout: abc\n", wantErr: "invalid prometheus.timeout"},
+		{name: "duration without unit", content: "prometheus:\n  timeout: 30\n", wantErr: "invalid prometheus.timeout"},
+		{name: "invalid number", content: "prometheus:\n  max_retries: three\n", wantErr: "invalid prometheus.max_retries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings bytes.Buffer
+			err := validateConfig(configFrom(t, tt.content), &warnings)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.wantWarning == "" && warnings.Len() > 0 {
+				t.Errorf("unexpected warnings: %s", warnings.String())
+			}
+			if tt.wantWarning != "" && !strings.HasPrefix(warnings.String(), tt.wantWarning) {
+				t.Errorf("warnings = %q, want %q", warnings.String(), tt.wantWarning)
+			}
+		})
+	}
+}
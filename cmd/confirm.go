@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// expensiveQueryPoints is the estimated number of points above which range queries need confirmation
+	expensiveQueryPoints = 100000
+	// allNamespacesWeight is how many namespaces a query over all namespaces is counted as, since it selects the
+	// series of the whole cluster at once
+	allNamespacesWeight = 20
+)
+
+// assumeYes skips the confirmation of expensive queries, set by --yes
+var assumeYes bool
+
+// estimateQueryCost estimates the load of running a range query over window at step for every namespace, as the
+// number of points Prometheus evaluates. The empty namespace, for all namespaces, counts as allNamespacesWeight.
+func estimateQueryCost(namespaces []string, window, step time.Duration) int64 {
+	if step <= 0 {
+		return 0
+	}
+	var weight int64
+	for _, namespace := range namespaces {
+		if namespace == "" {
+			weight += allNamespacesWeight
+		} else {
+			weight++
+		}
+	}
+	return weight * (int64(window/step) + 1)
+}
+
+// confirmExpensiveQuery asks for confirmation on the terminal before running range queries estimated to cost more
+// than expensiveQueryPoints. It never prompts with --yes or --dry-run, or when stdin or stdout isn't a terminal,
+// so that scripts and scheduled runs can't block.
+func confirmExpensiveQuery(namespaces []string, window, step time.Duration) error {
+	cost := estimateQueryCost(namespaces, window, step)
+	if cost <= expensiveQueryPoints || assumeYes || dryRun {
+		return nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "This runs range queries over %s at a step of %s for %s, about %d points. Continue? [y/N] ",
+		formatPrometheusDuration(window), formatPrometheusDuration(step), describeNamespaceCount(namespaces), cost)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("reading confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("aborted: pass --yes to run expensive queries without confirmation")
+}
+
+// describeNamespaceCount returns how the namespaces of a run are referred to in the confirmation prompt
+func describeNamespaceCount(namespaces []string) string {
+	if len(namespaces) == 1 {
+		return describeNamespace(namespaces[0])
+	}
+	return fmt.Sprintf("%d namespaces", len(namespaces))
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateQueryCost(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		window     time.Duration
+		step       time.Duration
+		want       int64
+	}{
+		{name: "one namespace", namespaces: []string{"a"}, window: time.Hour, step: time.Minute, want: 61},
+		{name: "several namespaces", namespaces: []string{"a", "b", "c"}, window: time.Hour, step: time.Minute, want: 183},
+		{name: "all namespaces", namespaces: []string{""}, window: time.Hour, step: time.Minute, want: allNamespacesWeight * 61},
+		{name: "30 days of all namespaces", namespaces: []string{""}, window: 30 * 24 * time.Hour, step: time.Minute, want: allNamespacesWeight * 43201},
+		{name: "invalid step", namespaces: []string{"a"}, window: time.Hour, step: 0, want: 0},
+		{name: "no namespaces", window: time.Hour, step: time.Minute, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateQueryCost(tt.namespaces, tt.window, tt.step); got != tt.want {
+				t.Errorf("estimateQueryCost() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmExpensiveQueryNeverBlocksNonInteractiveRuns(t *testing.T) {
+	// Tests run with stdin and stdout that aren't terminals, as in scripts and scheduled runs
+	namespaces, window := []string{""}, 30*24*time.Hour
+	if cost := estimateQueryCost(namespaces, window, time.Minute); cost <= expensiveQueryPoints {
+		t.Fatalf("estimated cost %d doesn't need confirmation", cost)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- confirmExpensiveQuery(namespaces, window, time.Minute) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("confirmExpensiveQuery() = %v, want the query to run", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("confirmExpensiveQuery() is waiting for an answer")
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// dryRun prints the Prometheus queries instead of sending them when set by --dry-run. Every query returns no data,
+// so queries that a command only runs depending on the results of others are not printed.
+var dryRun bool
+
+// dryRunOutput is where the queries are printed, the real stdout while the report is discarded
+var dryRunOutput io.Writer = os.Stdout
+
+// dryRunPrinted holds the requests printed so far, so that a query is listed once however often it is run.
+// It is shared by the namespaces queried in parallel.
+var dryRunPrinted = struct {
+	sync.Mutex
+	requests map[string]bool
+}{requests: map[string]bool{}}
+
+// startDryRun discards the report of the command with --dry-run, since it would be computed from empty results.
+// Only the queries the command runs are printed.
+func startDryRun() error {
+	if !dryRun {
+		return nil
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("discarding output for --dry-run: %w", err)
+	}
+	dryRunOutput = os.Stdout
+	os.Stdout = devNull
+	return nil
+}
+
+// printDryRunRequest prints a request to Prometheus unless it was printed before, separating requests by a blank line
+func printDryRunRequest(request string) {
+	dryRunPrinted.Lock()
+	defer dryRunPrinted.Unlock()
+
+	if dryRunPrinted.requests[request] {
+		return
+	}
+	if len(dryRunPrinted.requests) > 0 {
+		fmt.Fprintln(dryRunOutput)
+	}
+	dryRunPrinted.requests[request] = true
+	fmt.Fprintln(dryRunOutput, request)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// useDryRun enables --dry-run for the duration of the test against a Prometheus stub failing the test if it is
+// contacted, and returns where the queries are printed
+func useDryRun(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s with --dry-run", r.URL)
+	})
+	savedOutput, savedOffset, savedInstant := dryRunOutput, evaluationOffset, evaluationInstant
+	t.Cleanup(func() {
+		dryRunOutput, evaluationOffset, evaluationInstant = savedOutput, savedOffset, savedInstant
+		dryRunPrinted.requests = map[string]bool{}
+	})
+
+	var output bytes.Buffer
+	dryRun, dryRunOutput = true, &output
+	dryRunPrinted.requests = map[string]bool{}
+	return &output
+}
+
+func TestDryRunPrintsQueries(t *testing.T) {
+	output := useDryRun(t)
+	evaluationOffset, evaluationInstant = 0, time.Time{}
+
+	samples, err := queryPrometheusVector(context.Background(), "sum(up)")
+	if err != nil || len(samples) != 0 {
+		t.Errorf("queryPrometheusVector() = %v, %v, want no data and no error", samples, err)
+	}
+	// A query is printed once however often it runs
+	queryPrometheusVector(context.Background(), "sum(up)")
+	queryPrometheusVector(context.Background(), "count(up)")
+
+	if want := "sum(up)\n\ncount(up)\n"; output.String() != want {
+		t.Errorf("printed %q, want %q", output.String(), want)
+	}
+}
+
+func TestDryRunPrintsEvaluationOffset(t *testing.T) {
+	output := useDryRun(t)
+	evaluationOffset = time.Minute
+	evaluationInstant = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := queryPrometheusVector(context.Background(), "sum(up)"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "# evaluated at 2024-05-01T12:00:00Z\nsum(up)\n"; output.String() != want {
+		t.Errorf("printed %q, want %q", output.String(), want)
+	}
+}
+
+func TestDryRunPrintsRangeQueries(t *testing.T) {
+	output := useDryRun(t)
+
+	end := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	series, err := queryPrometheusRange(context.Background(), "sum(up)", end.Add(-time.Hour), end, time.Minute)
+	if err != nil || len(series) != 0 {
+		t.Errorf("queryPrometheusRange() = %v, %v, want no data and no error", series, err)
+	}
+	if want := "# range from 2024-05-01T11:00:00Z to 2024-05-01T12:00:00Z, step 1m\nsum(up)\n"; output.String() != want {
+		t.Errorf("printed %q, want %q", output.String(), want)
+	}
+}
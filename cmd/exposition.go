@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metricPrefix is the prefix of the names of the metrics printed with -o prometheus
+const metricPrefix = "k8s_capacity_"
+
+// metricFamily is a gauge and its samples in the Prometheus text exposition format
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+// metricSample is a sample of a metric family with its labels as name and value pairs, in order
+type metricSample struct {
+	labels []string
+	value  float64
+}
+
+// add appends a sample with labels given as alternating names and values, dropping labels with an empty value
+func (f *metricFamily) add(value float64, labels ...string) {
+	var kept []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		if labels[i+1] != "" {
+			kept = append(kept, labels[i], labels[i+1])
+		}
+	}
+	f.samples = append(f.samples, metricSample{labels: kept, value: value})
+}
+
+// labelValueEscaper escapes label values as required by the text exposition format
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetricFamilies writes the families that have samples in the Prometheus text exposition format
+func writeMetricFamilies(b *strings.Builder, families []*metricFamily) {
+	for _, family := range families {
+		if len(family.samples) == 0 {
+			continue
+		}
+		name := metricPrefix + family.name
+		fmt.Fprintf(b, "# HELP %s %s\n", name, family.help)
+		fmt.Fprintf(b, "# TYPE %s gauge\n", name)
+		for _, sample := range family.samples {
+			b.WriteString(name)
+			if len(sample.labels) > 0 {
+				pairs := make([]string, 0, len(sample.labels)/2)
+				for i := 0; i < len(sample.labels); i += 2 {
+					pairs = append(pairs, fmt.Sprintf(`%s="%s"`, sample.labels[i], labelValueEscaper.Replace(sample.labels[i+1])))
+				}
+				b.WriteString("{" + strings.Join(pairs, ",") + "}")
+			}
+			fmt.Fprintf(b, " %s\n", strconv.FormatFloat(sample.value, 'g', -1, 64))
+		}
+	}
+}
+
+// printAnalysisMetrics prints the analyses of the namespaces as Prometheus metrics. The metrics of an analysis over
+// all namespaces have no namespace label.
+func printAnalysisMetrics(results []analysis) {
+	cpuUsage := &metricFamily{name: "cpu_usage_cores", help: "CPU used by the containers of the namespace in cores."}
+	cpuRequests := &metricFamily{name: "cpu_requests_cores", help: "CPU requested by the containers of the namespace in cores."}
+	cpuUtilization := &metricFamily{name: "cpu_utilization_ratio", help: "CPU usage of the namespace as a ratio of its CPU requests."}
+	overProvisioned := &metricFamily{name: "cpu_over_provisioned", help: "Whether the CPU usage of the namespace is below --fail-over-ratio of its requests."}
+	workloadUsage := &metricFamily{name: "workload_cpu_usage_cores", help: "CPU used by the pods of the workload in cores."}
+	imageUsage := &metricFamily{name: "image_cpu_usage_cores", help: "CPU used by the containers running the image in cores."}
+	gpuRequests := &metricFamily{name: "gpu_requests", help: "NVIDIA GPUs requested by the containers of the namespace."}
+	gpuDevices := &metricFamily{name: "gpu_devices", help: "NVIDIA GPUs assigned to the running pods of the namespace."}
+	gpuUtilization := &metricFamily{name: "gpu_utilization_ratio", help: "Average utilization of the GPUs assigned to the namespace."}
+	networkReceive := &metricFamily{name: "network_receive_bytes_per_second", help: "Bytes received per second by the pods of the namespace."}
+	networkTransmit := &metricFamily{name: "network_transmit_bytes_per_second", help: "Bytes transmitted per second by the pods of the namespace."}
+	pvcUsed := &metricFamily{name: "pvc_used_bytes", help: "Bytes used on the volume of the PersistentVolumeClaim."}
+	pvcCapacity := &metricFamily{name: "pvc_capacity_bytes", help: "Capacity in bytes of the volume of the PersistentVolumeClaim."}
+	namespaceMemory := &metricFamily{name: "memory_working_set_bytes", help: "Memory working set of the containers of the namespace in bytes."}
+	memoryWorkingSet := &metricFamily{name: "container_memory_working_set_bytes", help: "Memory working set of the container in bytes."}
+	memoryLimit := &metricFamily{name: "container_memory_limit_bytes", help: "Memory limit of the container in bytes, absent when it has none."}
+	podThrottled := &metricFamily{name: "pod_cpu_throttled_ratio", help: "Fraction of the CFS periods of the pod in which its CPU limits throttled it."}
+	quotaUsed := &metricFamily{name: "quota_used", help: "Used amount of a resource of the ResourceQuota."}
+	quotaHard := &metricFamily{name: "quota_hard", help: "Hard limit of a resource of the ResourceQuota."}
+
+	for _, result := range results {
+		if cpu := result.CPU; cpu != nil {
+			cpuUsage.add(cpu.Usage, "namespace", result.Namespace)
+			cpuRequests.add(cpu.Requests, "namespace", result.Namespace)
+			if cpu.UtilizationPct != nil {
+				cpuUtilization.add(*cpu.UtilizationPct/100, "namespace", result.Namespace)
+			}
+			if failOverRatio > 0 {
+				overProvisioned.add(boolValue(cpu.OverProvisioned), "namespace", result.Namespace)
+			}
+		}
+		for _, workload := range result.Workloads {
+			workloadUsage.add(workload.Usage, "namespace", workload.Namespace, "kind", workload.Kind, "workload", workload.Name)
+		}
+		for _, image := range result.Images {
+			imageUsage.add(image.Usage, "namespace", result.Namespace, "image", image.Image)
+		}
+		if gpu := result.GPU; gpu != nil {
+			gpuRequests.add(gpu.Requests, "namespace", result.Namespace)
+			gpuDevices.add(gpu.Devices, "namespace", result.Namespace)
+			if gpu.UtilizationPct != nil {
+				gpuUtilization.add(*gpu.UtilizationPct/100, "namespace", result.Namespace)
+			}
+		}
+		if network := result.Network; network != nil {
+			networkReceive.add(network.Receive, "namespace", result.Namespace)
+			networkTransmit.add(network.Transmit, "namespace", result.Namespace)
+		}
+		for _, claim := range result.Storage {
+			labels := []string{"namespace", claim.Namespace, "persistentvolumeclaim", claim.PersistentVolumeClaim}
+			pvcUsed.add(claim.Used, labels...)
+			pvcCapacity.add(claim.Capacity, labels...)
+		}
+		if result.MemoryWorkingSet != nil {
+			namespaceMemory.add(*result.MemoryWorkingSet, "namespace", result.Namespace)
+		}
+		for _, container := range result.Memory {
+			labels := []string{"namespace", container.Namespace, "pod", container.Pod, "container", container.Container}
+			memoryWorkingSet.add(container.WorkingSet, labels...)
+			if container.Limit != nil {
+				memoryLimit.add(*container.Limit, labels...)
+			}
+		}
+		for _, pod := range result.Throttling {
+			if pod.ThrottledRatio != nil {
+				podThrottled.add(*pod.ThrottledRatio, "namespace", pod.Namespace, "pod", pod.Pod)
+			}
+		}
+		for _, quota := range result.Quotas {
+			namespace := quota.Namespace
+			if namespace == "" {
+				namespace = result.Namespace
+			}
+			labels := []string{"namespace", namespace, "resourcequota", quota.ResourceQuota, "resource", quota.Resource}
+			quotaUsed.add(quota.Used, labels...)
+			quotaHard.add(quota.Hard, labels...)
+		}
+	}
+
+	// Sort the workloads so that runs produce the same output whatever the order of the usage
+	sort.SliceStable(workloadUsage.samples, func(i, j int) bool {
+		return strings.Join(workloadUsage.samples[i].labels, "\x00") < strings.Join(workloadUsage.samples[j].labels, "\x00")
+	})
+
+	var b strings.Builder
+	writeMetricFamilies(&b, []*metricFamily{
+		cpuUsage, cpuRequests, cpuUtilization, overProvisioned, workloadUsage, imageUsage,
+		gpuRequests, gpuDevices, gpuUtilization, networkReceive, networkTransmit, pvcUsed, pvcCapacity,
+		namespaceMemory, memoryWorkingSet, memoryLimit, podThrottled, quotaUsed, quotaHard,
+	})
+	fmt.Fprint(os.Stdout, b.String())
+}
+
+// boolValue returns 1 for true and 0 for false
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
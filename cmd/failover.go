@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	// prometheusEndpoints are the base URLs of the Prometheus replicas set with prometheus.url, tried in order when
+	// one can't be reached. The first one is also prometheusURL, which the request URLs are built with.
+	prometheusEndpoints []string
+	// activeEndpoint is the index of the endpoint that last answered, where the next request starts so that a
+	// replica that is down costs one failed connection rather than one per query
+	activeEndpoint atomic.Int32
+)
+
+// errAllEndpointsFailed is returned by withPrometheusFailover when none of several endpoints could be reached
+var errAllEndpointsFailed = errors.New("all Prometheus endpoints failed")
+
+// prometheusURLsFromConfig returns the Prometheus URLs set with prometheus.url, which is either a single URL, a
+// comma-separated list of URLs as given with --prometheus-url or PROMETHEUS_URL, or a list in the config file
+func prometheusURLsFromConfig() []string {
+	var urls []string
+	switch value := viper.Get("prometheus.url").(type) {
+	case []interface{}:
+		for _, u := range value {
+			urls = append(urls, strings.TrimSpace(fmt.Sprint(u)))
+		}
+	default:
+		for _, u := range strings.Split(viper.GetString("prometheus.url"), ",") {
+			urls = append(urls, strings.TrimSpace(u))
+		}
+	}
+
+	var nonEmpty []string
+	for _, u := range urls {
+		if u != "" {
+			nonEmpty = append(nonEmpty, u)
+		}
+	}
+	return uniqueStrings(nonEmpty)
+}
+
+// withPrometheusFailover calls fn with the base URL of every Prometheus endpoint in turn, starting from the one that
+// last answered, until an endpoint is reached. Errors other than connection failures, such as a failed query, are
+// returned as is. When no endpoint can be reached the failures of all of them are returned.
+func withPrometheusFailover(ctx context.Context, fn func(endpoint string) error) error {
+	start := int(activeEndpoint.Load())
+	var errs []error
+	for i := range prometheusEndpoints {
+		n := (start + i) % len(prometheusEndpoints)
+		endpoint := prometheusEndpoints[n]
+		err := fn(endpoint)
+		if !isConnectionError(err) || ctx.Err() != nil {
+			if n != start && activeEndpoint.CompareAndSwap(int32(start), int32(n)) {
+				logger.Info("Failed over to Prometheus endpoint", "url", redactURL(endpoint))
+			}
+			return err
+		}
+		if len(prometheusEndpoints) > 1 {
+			logger.Debug("Prometheus endpoint unreachable", "url", redactURL(endpoint), "error", err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", redactURL(endpoint), err))
+	}
+	if len(errs) == 1 {
+		return errors.Unwrap(errs[0])
+	}
+	return fmt.Errorf("%w: %w", errAllEndpointsFailed, errors.Join(errs...))
+}
+
+// isConnectionError reports whether err is a failure to get a response from Prometheus, as opposed to an error
+// response, which another replica would most likely return too
+func isConnectionError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
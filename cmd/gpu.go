@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+)
+
+// gpuUsage compares the NVIDIA GPUs used by a namespace, as reported by DCGM exporter, with the GPUs its containers request
+type gpuUsage struct {
+	Requests float64 `json:"requests"` // nvidia.com/gpu requested
+	Devices  float64 `json:"devices"`  // GPUs assigned to running pods
+	// UtilizationPct is the average utilization of the assigned GPUs, nil when DCGM exporter reports none
+	UtilizationPct *float64 `json:"utilizationPct"`
+}
+
+// queryGPUUsage returns the GPU usage of a namespace, or of the whole cluster if it is empty.
+// It returns nil when neither DCGM exporter nor kube-state-metrics report any GPU for the namespace.
+func queryGPUUsage(ctx context.Context, namespace string) (*gpuUsage, error) {
+	requests, err := queryPrometheusVector(ctx, namespaceGPURequestsQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying GPU requests: %w", err)
+	}
+	devices, err := queryPrometheusVector(ctx, namespaceGPUDevicesQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying GPU devices: %w", err)
+	}
+	if len(requests) == 0 && len(devices) == 0 {
+		return nil, nil
+	}
+
+	usage := &gpuUsage{}
+	if len(requests) > 0 {
+		usage.Requests = requests[0].Value
+	}
+	if len(devices) > 0 {
+		usage.Devices = devices[0].Value
+		utilization, err := queryPrometheusVector(ctx, namespaceGPUUtilizationQuery(namespace))
+		if err != nil {
+			return nil, fmt.Errorf("querying GPU utilization: %w", err)
+		}
+		if len(utilization) > 0 {
+			usage.UtilizationPct = &utilization[0].Value
+		}
+	}
+	return usage, nil
+}
+
+// printGPUUsage prints the GPU usage of a namespace in text format
+func printGPUUsage(namespace string, usage *gpuUsage) {
+	if usage == nil {
+		fmt.Printf("  No GPU metrics found for %s (no GPU requests, or DCGM exporter unavailable)\n", describeNamespace(namespace))
+		return
+	}
+	fmt.Printf("  GPU requests:    %g\n", usage.Requests)
+	fmt.Printf("  GPUs in use:     %g\n", usage.Devices)
+	if usage.UtilizationPct == nil {
+		fmt.Println("  GPU utilization: no DCGM exporter data")
+	} else {
+		fmt.Printf("  GPU utilization: %.*f%%\n", decimals(1), *usage.UtilizationPct)
+	}
+}
+
+// gpuUsageRows returns the GPU usage of a namespace as rows of the METRIC, VALUE, UNIT table
+func gpuUsageRows(usage *gpuUsage) [][]string {
+	if usage == nil {
+		return [][]string{{"GPU usage", "no data", ""}}
+	}
+	utilization := []string{"GPU utilization", "no data", ""}
+	if usage.UtilizationPct != nil {
+		utilization = []string{"GPU utilization", fmt.Sprintf("%.*f", decimals(1), *usage.UtilizationPct), "%"}
+	}
+	return [][]string{
+		{"GPU requests", fmt.Sprintf("%g", usage.Requests), "gpus"},
+		{"GPUs in use", fmt.Sprintf("%g", usage.Devices), "gpus"},
+		utilization,
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+var (
+	history       string        // Raw value of --history, empty to use quantile_over_time over --timewindow
+	historyWindow time.Duration // Parsed --history
+	historyStep   time.Duration // Resolution of the samples fetched with --history
+)
+
+// queryUsageHistory computes the usage percentiles of the containers matching selector over all the samples of the
+// last history window of opts. Pooling the samples of every pod of the container gives percentiles of the container as a whole,
+// where quantile_over_time gives one per pod.
+func queryUsageHistory(ctx context.Context, selector string, opts recommendOptions) containerUsage {
+	end := evaluationNow()
+	start := end.Add(-opts.historyWindow)
+
+	var usage containerUsage
+	if opts.includesCPU() {
+		series, err := queryPrometheusRange(ctx, containerCPUUsageQuery(selector), start, end, opts.historyStep)
+		if err != nil {
+			usage.cpuErr = err
+		} else {
+			usage.cpuRequest, usage.hasCPU = percentileOverSeries(series, opts.requestPercentile)
+			usage.cpuLimit, _ = percentileOverSeries(series, opts.cpuPercentile)
+		}
+	}
+	if opts.includesMemory() {
+		series, err := queryPrometheusRange(ctx, containerMemoryUsageQuery(selector), start, end, opts.historyStep)
+		if err != nil {
+			usage.memoryErr = err
+		} else {
+			usage.memoryRequest, usage.hasMemory = percentileOverSeries(series, opts.requestPercentile)
+			usage.memoryLimit, _ = percentileOverSeries(series, opts.memoryPercentile)
+		}
+	}
+	return usage
+}
+
+// percentileOverSeries returns the q-quantile of the samples of all series, interpolating between the closest
+// samples like quantile_over_time does. The boolean is false when there are no samples.
+func percentileOverSeries(series []prometheusSeries, q float64) (float64, bool) {
+	var values []float64
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			if !math.IsNaN(sample.Value) {
+				values = append(values, sample.Value)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return 0, false
+	}
+	sort.Float64s(values)
+
+	rank := q * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return values[lower]*(1-weight) + values[upper]*weight, true
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+)
+
+// seriesOf returns a series with a sample of every value
+func seriesOf(values ...float64) prometheusSeries {
+	var s prometheusSeries
+	for _, value := range values {
+		s.Samples = append(s.Samples, prometheusSample{Value: value})
+	}
+	return s
+}
+
+func TestPercentileOverSeries(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []prometheusSeries
+		q      float64
+		want   float64
+		wantOK bool
+	}{
+		{name: "no series", q: 0.5},
+		{name: "series without samples", series: []prometheusSeries{seriesOf()}, q: 0.5},
+		{name: "only NaN", series: []prometheusSeries{seriesOf(math.NaN())}, q: 0.5},
+		{name: "single sample", series: []prometheusSeries{seriesOf(3)}, q: 0.95, want: 3, wantOK: true},
+		{name: "median of an odd count", series: []prometheusSeries{seriesOf(5, 1, 3)}, q: 0.5, want: 3, wantOK: true},
+		{name: "interpolated between samples", series: []prometheusSeries{seriesOf(1, 2, 3, 4)}, q: 0.5, want: 2.5, wantOK: true},
+		{name: "minimum", series: []prometheusSeries{seriesOf(4, 2, 8)}, q: 0, want: 2, wantOK: true},
+		{name: "maximum", series: []prometheusSeries{seriesOf(4, 2, 8)}, q: 1, want: 8, wantOK: true},
+		{name: "samples of all series are pooled", series: []prometheusSeries{seriesOf(1, 2), seriesOf(3, 4, 5)}, q: 0.75, want: 4, wantOK: true},
+		{name: "NaN samples are skipped", series: []prometheusSeries{seriesOf(1, math.NaN(), 3)}, q: 0.5, want: 2, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := percentileOverSeries(tt.series, tt.q)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("percentileOverSeries() = %g, %t, want %g, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
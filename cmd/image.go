@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	analyzeByImage bool // Break down the CPU usage by container image, set by --by-image
+	stripRegistry  bool // Drop the registry host from image names, set by --strip-registry
+)
+
+// imageCPUUsage is the CPU usage of the containers running an image
+type imageCPUUsage struct {
+	Image string  `json:"image"`
+	Usage float64 `json:"usage"` // Cores in use
+}
+
+// queryImageCPUUsage returns the CPU usage of the containers of a namespace by image, highest first.
+// Images from different registries that are the same once --strip-registry is applied are added up.
+func queryImageCPUUsage(ctx context.Context, namespace string) ([]imageCPUUsage, error) {
+	samples, err := queryPrometheusVector(ctx, imageCPUUsageQuery(namespace))
+	if err != nil {
+		return nil, err
+	}
+
+	byImage := map[string]float64{}
+	for _, sample := range samples {
+		image := sample.Metric["image"]
+		if stripRegistry {
+			image = stripImageRegistry(image)
+		}
+		byImage[image] += sample.Value
+	}
+
+	images := make([]imageCPUUsage, 0, len(byImage))
+	for image, usage := range byImage {
+		images = append(images, imageCPUUsage{Image: image, Usage: usage})
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].Usage != images[j].Usage {
+			return images[i].Usage > images[j].Usage
+		}
+		return images[i].Image < images[j].Image
+	})
+	return images, nil
+}
+
+// stripImageRegistry drops the registry host from an image reference, e.g. registry.example.com:5000/team/app:1.2
+// becomes team/app:1.2. As in Docker, the first path component is a registry when it contains a dot or a port, or
+// is localhost. Images without one, such as nginx:1.25, are returned unchanged.
+func stripImageRegistry(image string) string {
+	host, rest, found := strings.Cut(image, "/")
+	if !found {
+		return image
+	}
+	if strings.ContainsAny(host, ".:") || host == "localhost" {
+		return rest
+	}
+	return image
+}
+
+// imageCPUUsageRows returns the table rows of the CPU usage by image
+func imageCPUUsageRows(images []imageCPUUsage) [][]string {
+	rows := make([][]string, 0, len(images))
+	for _, image := range images {
+		rows = append(rows, []string{image.Image, formatCPU(image.Usage)})
+	}
+	return rows
+}
+
+// printImageCPUUsage prints the CPU usage by image in text format
+func printImageCPUUsage(images []imageCPUUsage) {
+	if len(images) == 0 {
+		fmt.Println("  No CPU usage by image found (kube_pod_container_info unavailable)")
+		return
+	}
+	fmt.Println("  CPU usage by image:")
+	images, more := limitRows(images)
+	for _, image := range images {
+		fmt.Printf("    %s: %s\n", image.Image, formatCPU(image.Usage))
+	}
+	printMoreRows("    ", more)
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// labelsLookback is how far back series are looked for, set by --lookback
+var labelsLookback time.Duration
+
+// labelValueCount is a value of a label and the number of series that have it
+type labelValueCount struct {
+	Value  string `json:"value"`
+	Series int    `json:"series"`
+}
+
+// labelNameCount is a label and the number of distinct values it has
+type labelNameCount struct {
+	Label  string `json:"label"`
+	Values int    `json:"values"`
+}
+
+// labelsCmd represents the labels command
+var labelsCmd = &cobra.Command{
+	Use:   "labels <metric|selector> [label]",
+	Short: "List the labels of a metric, or the values of one of its labels",
+	Long: `Labels looks up the series of a metric, or of any series selector, that existed over the
+last --lookback using the Prometheus series API, which is cheap since no sample is loaded.
+
+Without a label it lists the labels of those series with how many distinct values each has.
+With a label it lists the values of that label with how many series have each. This helps
+writing query templates, e.g. to find what a cluster calls the namespace label.`,
+	Example: `  k labels container_cpu_usage_seconds_total
+  k labels container_cpu_usage_seconds_total namespace
+  k labels 'kube_pod_info{namespace="team-a"}' node`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 || len(args) > 2 || strings.TrimSpace(args[0]) == "" {
+			return fmt.Errorf("expected a metric or series selector and optionally a label, e.g. k labels up job")
+		}
+		return nil
+	},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if labelsLookback <= 0 {
+			return fmt.Errorf("invalid lookback %s: must be positive", labelsLookback)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		end := evaluationNow()
+		series, err := querySeries(cmd.Context(), []string{args[0]}, end.Add(-labelsLookback), end)
+		if err != nil {
+			return fmt.Errorf("looking up series of %s: %w", args[0], err)
+		}
+		if dryRun {
+			return nil
+		}
+
+		if len(args) == 2 {
+			values := countLabelValues(series, args[1])
+			if outputFormat == "json" {
+				return printJSON(values)
+			}
+			if len(values) == 0 {
+				fmt.Printf("No series of %s with label %s found over the last %s\n", args[0], args[1], formatPrometheusDuration(labelsLookback))
+				return nil
+			}
+			rows := make([][]string, 0, len(values))
+			for _, value := range values {
+				rows = append(rows, []string{value.Value, strconv.Itoa(value.Series)})
+			}
+			printLabelRows([]string{strings.ToUpper(args[1]), "SERIES"}, rows)
+			return nil
+		}
+
+		names := countLabelNames(series)
+		if outputFormat == "json" {
+			return printJSON(names)
+		}
+		if len(names) == 0 {
+			fmt.Printf("No series of %s found over the last %s\n", args[0], formatPrometheusDuration(labelsLookback))
+			return nil
+		}
+		rows := make([][]string, 0, len(names))
+		for _, name := range names {
+			rows = append(rows, []string{name.Label, strconv.Itoa(name.Values)})
+		}
+		printLabelRows([]string{"LABEL", "VALUES"}, rows)
+		return nil
+	},
+}
+
+// countLabelValues counts the series having each value of a label, ordered by value. Series without the label are
+// not counted.
+func countLabelValues(series []map[string]string, label string) []labelValueCount {
+	counts := map[string]int{}
+	for _, labels := range series {
+		if value, ok := labels[label]; ok {
+			counts[value]++
+		}
+	}
+	values := make([]labelValueCount, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, labelValueCount{Value: value, Series: count})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Value < values[j].Value })
+	return values
+}
+
+// countLabelNames counts the distinct values of every label of the series, ordered by label, leaving out the metric name
+func countLabelNames(series []map[string]string) []labelNameCount {
+	values := map[string]map[string]bool{}
+	for _, labels := range series {
+		for name, value := range labels {
+			if name == "__name__" {
+				continue
+			}
+			if values[name] == nil {
+				values[name] = map[string]bool{}
+			}
+			values[name][value] = true
+		}
+	}
+	names := make([]labelNameCount, 0, len(values))
+	for name, distinct := range values {
+		names = append(names, labelNameCount{Label: name, Values: len(distinct)})
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Label < names[j].Label })
+	return names
+}
+
+// printLabelRows prints label names or values as a table, or one per line with their count in text format
+func printLabelRows(headers []string, rows [][]string) {
+	if outputFormat == "table" {
+		fmt.Print(renderTable(headers, rows))
+		return
+	}
+	for _, row := range rows {
+		fmt.Printf("%s (%s %s)\n", row[0], row[1], strings.ToLower(headers[1]))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(labelsCmd)
+
+	labelsCmd.Flags().DurationVar(&labelsLookback, "lookback", time.Hour, "Look for series that existed over this long before now")
+}
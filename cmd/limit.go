@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// rowLimit is the number of rows of a list shown in text and table output, 0 for all; set by --limit
+var rowLimit int
+
+// addLimitFlag registers the --limit flag on a command
+func addLimitFlag(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&rowLimit, "limit", 0, "Show only the first N rows of each list in text and table output, after --sort; 0 shows all")
+}
+
+// validateLimit checks --limit
+func validateLimit() error {
+	if rowLimit < 0 {
+		return fmt.Errorf("invalid limit %d: must not be negative", rowLimit)
+	}
+	return nil
+}
+
+// limitRows returns the rows shown with --limit and how many were left out
+func limitRows[T any](rows []T) ([]T, int) {
+	if rowLimit == 0 || len(rows) <= rowLimit {
+		return rows, 0
+	}
+	return rows[:rowLimit], len(rows) - rowLimit
+}
+
+// printMoreRows prints the footer of a list that --limit truncated
+func printMoreRows(indent string, more int) {
+	if more > 0 {
+		fmt.Printf("%s... and %d more\n", indent, more)
+	}
+}
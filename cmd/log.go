@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+var (
+	logLevel = new(slog.LevelVar) // Minimum level of diagnostic messages, info unless raised by --log-level
+	verbose  bool                 // Shorthand for --log-level debug
+	quiet    bool                 // Only log warnings and errors and skip informational notices, set by --quiet
+
+	// logger writes diagnostic messages to stderr, keeping them apart from the report on stdout
+	logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+)
+
+// configureLogging sets the log level from --log-level, or debug with --verbose or recommend's --debug, raised to
+// at least warn with --quiet, and the log format from --log-format
+func configureLogging() error {
+	format := viper.GetString("log.format")
+	if format == "" {
+		format = defaultLogFormat()
+	}
+	options := &slog.HandlerOptions{Level: logLevel}
+	switch format {
+	case "text":
+		logger = slog.New(slog.NewTextHandler(os.Stderr, options))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, options))
+	default:
+		return fmt.Errorf("invalid log format %q: must be one of text, json", format)
+	}
+
+	if verbose || debug {
+		if quiet {
+			return fmt.Errorf("--quiet can't be combined with --verbose or --debug")
+		}
+		logLevel.Set(slog.LevelDebug)
+		return nil
+	}
+
+	level := viper.GetString("log.level")
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: must be one of debug, info, warn, error", level)
+	}
+	if quiet && logLevel.Level() < slog.LevelWarn {
+		logLevel.Set(slog.LevelWarn)
+	}
+	return nil
+}
+
+// defaultLogFormat returns text when the logs are read in a terminal and json otherwise.
+// Logs go to stderr, so that is what is checked rather than stdout.
+func defaultLogFormat() string {
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		return "text"
+	}
+	return "json"
+}
+
+// redactURL hides the password of a URL so that it can be logged
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// Don't risk logging credentials that could not be located
+		return strings.SplitN(rawURL, "?", 2)[0]
+	}
+	return u.Redacted()
+}
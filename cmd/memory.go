@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// oomThreshold is the fraction of its memory limit above which a container is flagged as at risk of being OOM killed
+var oomThreshold float64
+
+// addOOMThresholdFlag registers the --oom-threshold flag on a command
+func addOOMThresholdFlag(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&oomThreshold, "oom-threshold", 0.9, "Flag containers whose memory working set is above this fraction of their memory limit with --resource memory")
+}
+
+// validateOOMThreshold checks --oom-threshold
+func validateOOMThreshold() error {
+	if oomThreshold <= 0 {
+		return fmt.Errorf("invalid OOM threshold %g: must be positive", oomThreshold)
+	}
+	return nil
+}
+
+// containerMemoryUsage is the memory working set of a container compared with its memory limit
+type containerMemoryUsage struct {
+	Namespace  string   `json:"namespace"`
+	Pod        string   `json:"pod"`
+	Container  string   `json:"container"`
+	WorkingSet float64  `json:"workingSet"` // Bytes in use, which the kernel can't reclaim
+	Limit      *float64 `json:"limit"`      // Memory limit in bytes, nil when the container has none and is unbounded
+	LimitRatio *float64 `json:"limitRatio"` // Working set as a fraction of the limit, nil when there is no limit
+	// OOMRisk is set when the working set is above --oom-threshold of the limit
+	OOMRisk bool `json:"oomRisk,omitempty"`
+}
+
+// memoryLimitRatio returns the working set as a fraction of the limit, or false when no limit is set
+func memoryLimitRatio(workingSet, limit float64) (float64, bool) {
+	if limit <= 0 {
+		return 0, false
+	}
+	return workingSet / limit, true
+}
+
+// queryMemoryUsage returns the memory working set of the running containers of a namespace with their limits,
+// closest to their limit first and unbounded containers last
+func queryMemoryUsage(ctx context.Context, namespace string) ([]containerMemoryUsage, error) {
+	workingSets, err := queryPrometheusVector(ctx, containerWorkingSetQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying memory working set: %w", err)
+	}
+	limits, err := queryPrometheusVector(ctx, containerMemoryLimitsQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying memory limits: %w", err)
+	}
+
+	type containerKey struct{ namespace, pod, container string }
+	limitByContainer := map[containerKey]float64{}
+	for _, sample := range limits {
+		limitByContainer[containerKey{sample.Metric["namespace"], sample.Metric["pod"], sample.Metric["container"]}] = sample.Value
+	}
+
+	containers := make([]containerMemoryUsage, 0, len(workingSets))
+	for _, sample := range workingSets {
+		key := containerKey{sample.Metric["namespace"], sample.Metric["pod"], sample.Metric["container"]}
+		container := containerMemoryUsage{Namespace: key.namespace, Pod: key.pod, Container: key.container, WorkingSet: sample.Value}
+		if limit, ok := limitByContainer[key]; ok {
+			container.Limit = &limit
+			if ratio, ok := memoryLimitRatio(sample.Value, limit); ok {
+				container.LimitRatio = &ratio
+				container.OOMRisk = ratio > oomThreshold
+			}
+		}
+		containers = append(containers, container)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		ri, rj := memoryLimitRatioOrUnknown(containers[i]), memoryLimitRatioOrUnknown(containers[j])
+		if ri != rj {
+			return ri > rj
+		}
+		if containers[i].WorkingSet != containers[j].WorkingSet {
+			return containers[i].WorkingSet > containers[j].WorkingSet
+		}
+		return containerMemoryDisplayName("", containers[i]) < containerMemoryDisplayName("", containers[j])
+	})
+	return containers, nil
+}
+
+// memoryLimitRatioOrUnknown returns the limit ratio of a container for sorting, -1 when it has no limit
+func memoryLimitRatioOrUnknown(container containerMemoryUsage) float64 {
+	if container.LimitRatio == nil {
+		return -1
+	}
+	return *container.LimitRatio
+}
+
+// containerMemoryDisplayName returns the pod and container, qualified with the namespace when reporting on all namespaces
+func containerMemoryDisplayName(namespace string, container containerMemoryUsage) string {
+	name := container.Pod + "/" + container.Container
+	if namespace == "" {
+		return container.Namespace + "/" + name
+	}
+	return name
+}
+
+// splitUnbounded separates the containers that have a memory limit from those that don't
+func splitUnbounded(containers []containerMemoryUsage) (bounded, unbounded []containerMemoryUsage) {
+	for _, container := range containers {
+		if container.Limit == nil {
+			unbounded = append(unbounded, container)
+		} else {
+			bounded = append(bounded, container)
+		}
+	}
+	return bounded, unbounded
+}
+
+// formatMemoryLimitRatio formats the working set of a container as a percentage of its limit
+func formatMemoryLimitRatio(container containerMemoryUsage) string {
+	if container.LimitRatio == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.*f%%", decimals(1), *container.LimitRatio*100)
+}
+
+// printMemoryUsage prints the memory working set of a namespace and the memory usage of its containers in text format
+func printMemoryUsage(namespace string, workingSet *float64, containers []containerMemoryUsage) {
+	if workingSet == nil && len(containers) == 0 {
+		fmt.Printf("  No memory usage data found for %s (no running pods or metric unavailable)\n", describeNamespace(namespace))
+		return
+	}
+	if workingSet != nil {
+		fmt.Printf("  Memory working set: %s\n", formatMemory(*workingSet))
+	}
+	bounded, unbounded := splitUnbounded(containers)
+	if len(bounded) > 0 {
+		fmt.Println("  Memory working set vs limit:")
+		shown, more := limitRows(bounded)
+		for _, container := range shown {
+			fmt.Printf("    %s: %s/%s (%s)", containerMemoryDisplayName(namespace, container),
+				formatMemory(container.WorkingSet), formatMemory(*container.Limit), formatMemoryLimitRatio(container))
+			if container.OOMRisk {
+				fmt.Print(" OOM risk")
+			}
+			fmt.Println()
+		}
+		printMoreRows("    ", more)
+	}
+	if len(unbounded) > 0 {
+		fmt.Println("  Unbounded containers without a memory limit:")
+		shown, more := limitRows(unbounded)
+		for _, container := range shown {
+			fmt.Printf("    %s: %s\n", containerMemoryDisplayName(namespace, container), formatMemory(container.WorkingSet))
+		}
+		printMoreRows("    ", more)
+	}
+}
+
+// printMemoryUsageTable prints the memory working set of a namespace and the memory usage of its containers as
+// aligned tables
+func printMemoryUsageTable(namespace string, workingSet *float64, containers []containerMemoryUsage) {
+	if workingSet == nil && len(containers) == 0 {
+		fmt.Println("No memory usage data found")
+		return
+	}
+	if workingSet != nil {
+		fmt.Printf("Memory working set: %s\n", formatMemory(*workingSet))
+		if len(containers) > 0 {
+			fmt.Println()
+		}
+	}
+	bounded, unbounded := splitUnbounded(containers)
+	if len(bounded) > 0 {
+		shown, more := limitRows(bounded)
+		rows := make([][]string, 0, len(shown))
+		for _, container := range shown {
+			status := ""
+			if container.OOMRisk {
+				status = colorize("OOM risk", colorRed)
+			}
+			ratio := formatMemoryLimitRatio(container)
+			if container.LimitRatio != nil {
+				ratio = colorizeStatus(ratio, container.OOMRisk)
+			}
+			rows = append(rows, []string{containerMemoryDisplayName(namespace, container), formatMemory(container.WorkingSet),
+				formatMemory(*container.Limit), ratio, status})
+		}
+		fmt.Print(renderTable([]string{"CONTAINER", "WORKING SET", "LIMIT", "OF LIMIT", "STATUS"}, rows))
+		printMoreRows("", more)
+	}
+	if len(unbounded) > 0 {
+		if len(bounded) > 0 {
+			fmt.Println()
+		}
+		shown, more := limitRows(unbounded)
+		rows := make([][]string, 0, len(shown))
+		for _, container := range shown {
+			rows = append(rows, []string{containerMemoryDisplayName(namespace, container), formatMemory(container.WorkingSet)})
+		}
+		fmt.Println("Unbounded containers without a memory limit:")
+		fmt.Print(renderTable([]string{"CONTAINER", "WORKING SET"}, rows))
+		printMoreRows("", more)
+	}
+}
+
+// warnOOMRisk reports the containers above --oom-threshold of their memory limit on stderr
+func warnOOMRisk(results []analysis) {
+	for _, result := range results {
+		for _, container := range result.Memory {
+			if container.OOMRisk {
+				fmt.Fprintf(os.Stderr, "Warning: container %s/%s/%s uses %s of its memory limit, above %g%%\n",
+					container.Namespace, container.Pod, container.Container, formatMemoryLimitRatio(container), oomThreshold*100)
+			}
+		}
+	}
+}
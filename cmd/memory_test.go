@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMemoryLimitRatio(t *testing.T) {
+	tests := []struct {
+		name              string
+		workingSet, limit float64
+		want              float64
+		wantOK            bool
+	}{
+		{name: "half of the limit", workingSet: 512 << 20, limit: 1 << 30, want: 0.5, wantOK: true},
+		{name: "at the limit", workingSet: 1 << 30, limit: 1 << 30, want: 1, wantOK: true},
+		{name: "above the limit", workingSet: 3 << 30, limit: 2 << 30, want: 1.5, wantOK: true},
+		{name: "nothing in use", workingSet: 0, limit: 1 << 30, want: 0, wantOK: true},
+		{name: "zero limit is unbounded", workingSet: 1 << 20, limit: 0},
+		{name: "negative limit is unbounded", workingSet: 1 << 20, limit: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := memoryLimitRatio(tt.workingSet, tt.limit)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("memoryLimitRatio(%g, %g) = %g, %t, want %g, %t", tt.workingSet, tt.limit, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestQueryMemoryUsage(t *testing.T) {
+	savedThreshold := oomThreshold
+	t.Cleanup(func() { oomThreshold = savedThreshold })
+	oomThreshold = 0.9
+
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.FormValue("query"), "kube_pod_container_resource_limits") {
+			respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"namespace":"a","pod":"web","container":"app"},"value":[1700000000,"1073741824"]},
+				{"metric":{"namespace":"a","pod":"db","container":"postgres"},"value":[1700000000,"1073741824"]}
+			]}}`)(w, r)
+			return
+		}
+		respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"namespace":"a","pod":"web","container":"app"},"value":[1700000000,"536870912"]},
+			{"metric":{"namespace":"a","pod":"db","container":"postgres"},"value":[1700000000,"1020054732.8"]},
+			{"metric":{"namespace":"a","pod":"web","container":"sidecar"},"value":[1700000000,"67108864"]}
+		]}}`)(w, r)
+	})
+
+	containers, err := queryMemoryUsage(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Closest to the limit first and the container without a limit last
+	want := []struct {
+		name    string
+		ratio   string
+		oomRisk bool
+	}{
+		{name: "db/postgres", ratio: "95.0%", oomRisk: true},
+		{name: "web/app", ratio: "50.0%"},
+		{name: "web/sidecar", ratio: "-"},
+	}
+	if len(containers) != len(want) {
+		t.Fatalf("got %d containers, want %d: %+v", len(containers), len(want), containers)
+	}
+	for i, w := range want {
+		container := containers[i]
+		name := containerMemoryDisplayName("a", container)
+		if name != w.name || formatMemoryLimitRatio(container) != w.ratio || container.OOMRisk != w.oomRisk {
+			t.Errorf("container %d = %s at %s, OOM risk %t, want %s at %s, OOM risk %t",
+				i, name, formatMemoryLimitRatio(container), container.OOMRisk, w.name, w.ratio, w.oomRisk)
+		}
+	}
+	if containers[2].Limit != nil {
+		t.Errorf("limit of the unbounded container = %g, want none", *containers[2].Limit)
+	}
+}
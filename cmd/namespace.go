@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeContext is the kubeconfig context the default namespace is read from, the current context if empty
+var kubeContext string
+
+// validateKubeContext checks that the context given with --context exists in the kubeconfig
+func validateKubeContext() error {
+	if kubeContext == "" {
+		return nil
+	}
+	rawConfig, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	if _, ok := rawConfig.Contexts[kubeContext]; ok {
+		return nil
+	}
+	contexts := make([]string, 0, len(rawConfig.Contexts))
+	for name := range rawConfig.Contexts {
+		contexts = append(contexts, name)
+	}
+	sort.Strings(contexts)
+	if len(contexts) == 0 {
+		return fmt.Errorf("context %q not found: the kubeconfig has no contexts", kubeContext)
+	}
+	return fmt.Errorf("context %q not found in the kubeconfig, available contexts: %s", kubeContext, strings.Join(contexts, ", "))
+}
+
+// addNamespaceFlags registers the flags selecting the namespaces a command reports on
+func addNamespaceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceP("namespace", "n", nil, "Namespaces to report on, repeated or comma-separated (default is the namespace of the current kube context)")
+	cmd.Flags().String("namespace-file", "", "File listing namespaces to report on, one per line, merged with --namespace; blank lines and # comments are ignored")
+	cmd.Flags().BoolP("all-namespaces", "A", false, "Report on all namespaces")
+	cmd.Flags().Bool("no-validate-namespace", false, "Don't check that the namespaces exist, e.g. where kube-state-metrics is unavailable")
+	cmd.MarkFlagsMutuallyExclusive("namespace", "all-namespaces")
+	cmd.MarkFlagsMutuallyExclusive("namespace-file", "all-namespaces")
+	cmd.RegisterFlagCompletionFunc("namespace", completeNamespaces)
+}
+
+// readNamespaceFile reads the namespaces listed in a file, one per line, skipping blank lines and # comments
+func readNamespaceFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading namespace file: %w", err)
+	}
+	var namespaces []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		namespaces = append(namespaces, line)
+	}
+	return namespaces, nil
+}
+
+// namespaceCompletionTimeout bounds the lookup of namespaces so that completion never blocks the shell
+const namespaceCompletionTimeout = 2 * time.Second
+
+// completeNamespaces completes --namespace with the namespaces of the cluster of the current kube context.
+// Nothing is completed when the cluster can't be reached in time.
+func completeNamespaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	clientset, err := newKubernetesClient()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), namespaceCompletionTimeout)
+	defer cancel()
+	namespaceList, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// --namespace takes comma-separated values, so complete the last one
+	prefix, last := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, last = toComplete[:i+1], toComplete[i+1:]
+	}
+	var namespaces []string
+	for _, ns := range namespaceList.Items {
+		if strings.HasPrefix(ns.Name, last) {
+			namespaces = append(namespaces, prefix+ns.Name)
+		}
+	}
+	return namespaces, cobra.ShellCompDirectiveNoFileComp
+}
+
+// namespacesFromFlags returns the namespaces selected on the command line and in --namespace-file, falling back to
+// the default namespace. With --all-namespaces, or a namespace file listing no namespace and no --namespace, it
+// returns a single empty namespace, for which queries drop the namespace selector.
+func namespacesFromFlags(cmd *cobra.Command) ([]string, error) {
+	if allNamespaces, _ := cmd.Flags().GetBool("all-namespaces"); allNamespaces {
+		return []string{""}, nil
+	}
+
+	namespaces, _ := cmd.Flags().GetStringSlice("namespace")
+	if namespaceFile, _ := cmd.Flags().GetString("namespace-file"); namespaceFile != "" {
+		fromFile, err := readNamespaceFile(namespaceFile)
+		if err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, fromFile...)
+		if len(namespaces) == 0 {
+			return []string{""}, nil
+		}
+	}
+	if len(namespaces) == 0 {
+		return []string{defaultNamespace()}, nil
+	}
+	// A namespace given twice, e.g. with -n a -n a,b, is only reported on once
+	return uniqueStrings(namespaces), nil
+}
+
+// validateNamespacesExist checks with kube-state-metrics that the namespaces exist, so that a misspelled namespace
+// is an error rather than a report without data. The check is skipped with --no-validate-namespace.
+func validateNamespacesExist(cmd *cobra.Command, namespaces []string) error {
+	if skip, _ := cmd.Flags().GetBool("no-validate-namespace"); skip || dryRun {
+		return nil
+	}
+	var named []string
+	for _, namespace := range namespaces {
+		if namespace != "" {
+			named = append(named, namespace)
+		}
+	}
+	if len(named) == 0 {
+		return nil
+	}
+
+	existing, err := existingNamespaces(cmd.Context(), named)
+	if err != nil {
+		return fmt.Errorf("checking that the namespaces exist: %w", err)
+	}
+	var missing []string
+	for _, namespace := range named {
+		if !existing[namespace] {
+			missing = append(missing, fmt.Sprintf("'%s'", namespace))
+		}
+	}
+	switch {
+	case len(missing) == 0:
+		return nil
+	case len(existing) == 0 && !useMetricsServer():
+		// Without a single namespace the metric itself is most likely missing
+		return fmt.Errorf("namespace %s not found: kube_namespace_created has no data, pass --no-validate-namespace if kube-state-metrics is unavailable", strings.Join(missing, ", "))
+	case len(missing) == 1:
+		return fmt.Errorf("namespace %s not found", missing[0])
+	}
+	return fmt.Errorf("namespaces %s not found", strings.Join(missing, ", "))
+}
+
+// uniqueStrings returns values without duplicates, keeping the first occurrence of each
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// defaultNamespace returns the namespace of the current kube context, or of the one given with --context,
+// or "default" if there is none or no kubeconfig can be loaded
+func defaultNamespace() string {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext})
+	namespace, _, err := clientConfig.Namespace()
+	switch {
+	case quiet:
+	case err != nil || namespace == "":
+		fmt.Fprintln(os.Stderr, "No namespace provided. Using the 'default' namespace.")
+	case kubeContext != "":
+		fmt.Fprintf(os.Stderr, "No namespace provided. Using the '%s' namespace of the '%s' kube context.\n", namespace, kubeContext)
+	default:
+		fmt.Fprintf(os.Stderr, "No namespace provided. Using the '%s' namespace of the current kube context.\n", namespace)
+	}
+	if err != nil || namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
+// namespaceMatcher returns the label matcher selecting a namespace, or no matcher for all namespaces
+func namespaceMatcher(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return "namespace=" + strconv.Quote(namespace)
+}
+
+// describeNamespace returns how a namespace is referred to in report headings
+func describeNamespace(namespace string) string {
+	if namespace == "" {
+		return "all namespaces"
+	}
+	return fmt.Sprintf("namespace '%s'", namespace)
+}
+
+// existingNamespaces returns which of the namespaces exist, asking the Kubernetes API when usage is read from
+// metrics-server as Prometheus may not be available
+func existingNamespaces(ctx context.Context, namespaces []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	if useMetricsServer() {
+		clientset, err := newKubernetesClient()
+		if err != nil {
+			return nil, err
+		}
+		namespaceList, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range namespaceList.Items {
+			existing[ns.Name] = true
+		}
+		return existing, nil
+	}
+
+	samples, err := queryPrometheusVector(ctx, namespacesCreatedQuery(namespaces))
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range samples {
+		existing[sample.Metric["namespace"]] = true
+	}
+	return existing, nil
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUniqueStrings(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{name: "empty", values: nil, want: []string{}},
+		{name: "no duplicates", values: []string{"b", "a", "c"}, want: []string{"b", "a", "c"}},
+		{name: "duplicates keep the first occurrence", values: []string{"b", "a", "b", "c", "a"}, want: []string{"b", "a", "c"}},
+		{name: "all the same", values: []string{"a", "a", "a"}, want: []string{"a"}},
+		{name: "empty strings are values too", values: []string{"", "a", ""}, want: []string{"", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uniqueStrings(tt.values); !slices.Equal(got, tt.want) {
+				t.Errorf("uniqueStrings(%q) = %q, want %q", tt.values, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// namespacesLookback is how far back namespaces are looked for, set by --lookback
+var namespacesLookback time.Duration
+
+// namespacesCmd represents the namespaces command
+var namespacesCmd = &cobra.Command{
+	Use:   "namespaces",
+	Short: "List the namespaces known to Prometheus",
+	Long: `Namespaces lists the values of the namespace label of the series that existed over the
+last --lookback, using the Prometheus label values API. Unlike listing the namespaces of the
+cluster, it shows what the reports can actually be run on, including namespaces deleted
+within the lookback. With --label only the series matching those labels are considered.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if namespacesLookback <= 0 {
+			return fmt.Errorf("invalid lookback %s: must be positive", namespacesLookback)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var matchers []string
+		if selector := labelSelector(); selector != "" {
+			matchers = append(matchers, "{"+selector+"}")
+		}
+		end := evaluationNow()
+		namespaces, err := queryLabelValues(cmd.Context(), "namespace", matchers, end.Add(-namespacesLookback), end)
+		if err != nil {
+			return fmt.Errorf("listing namespaces: %w", err)
+		}
+		if dryRun {
+			return nil
+		}
+		sort.Strings(namespaces)
+
+		if outputFormat == "json" {
+			return printJSON(namespaces)
+		}
+		if len(namespaces) == 0 {
+			fmt.Printf("No namespaces found over the last %s\n", formatPrometheusDuration(namespacesLookback))
+			return nil
+		}
+		if outputFormat == "table" {
+			rows := make([][]string, 0, len(namespaces))
+			for _, namespace := range namespaces {
+				rows = append(rows, []string{namespace})
+			}
+			fmt.Print(renderTable([]string{"NAMESPACE"}, rows))
+			return nil
+		}
+		for _, namespace := range namespaces {
+			fmt.Println(namespace)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(namespacesCmd)
+
+	namespacesCmd.Flags().DurationVar(&namespacesLookback, "lookback", time.Hour, "Look for namespaces of series that existed over this long before now")
+}
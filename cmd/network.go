@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// networkUsage is the network traffic of the pods of a namespace
+type networkUsage struct {
+	Receive  float64 `json:"receive"`  // Bytes received per second
+	Transmit float64 `json:"transmit"` // Bytes transmitted per second
+}
+
+// queryNetworkUsage returns the network traffic of a namespace, or of the whole cluster if it is empty.
+// It returns nil when there are no container network metrics, which is the case for pods using the host network
+// since their traffic is accounted to the node.
+func queryNetworkUsage(ctx context.Context, namespace string) (*networkUsage, error) {
+	receive, err := queryPrometheusValue(ctx, namespaceNetworkReceiveQuery(namespace))
+	if err != nil && !errors.Is(err, errNoData) {
+		return nil, fmt.Errorf("querying network receive rate: %w", err)
+	}
+	receiveFound := err == nil
+	transmit, err := queryPrometheusValue(ctx, namespaceNetworkTransmitQuery(namespace))
+	if err != nil && !errors.Is(err, errNoData) {
+		return nil, fmt.Errorf("querying network transmit rate: %w", err)
+	}
+	if !receiveFound && err != nil {
+		return nil, nil
+	}
+	return &networkUsage{Receive: receive, Transmit: transmit}, nil
+}
+
+// formatBandwidth formats a rate in bytes per second
+func formatBandwidth(bytesPerSecond float64) string {
+	return formatMemory(bytesPerSecond) + "/s"
+}
+
+// printNetworkUsage prints the network traffic of a namespace in text format
+func printNetworkUsage(namespace string, usage *networkUsage) {
+	if usage == nil {
+		fmt.Printf("  No network metrics found for %s (no running pods, or pods using the host network)\n", describeNamespace(namespace))
+		return
+	}
+	fmt.Printf("  Network receive (rx):  %s\n", formatBandwidth(usage.Receive))
+	fmt.Printf("  Network transmit (tx): %s\n", formatBandwidth(usage.Transmit))
+}
+
+// networkUsageRows returns the network traffic of a namespace as rows of the METRIC, VALUE, UNIT table
+func networkUsageRows(usage *networkUsage) [][]string {
+	if usage == nil {
+		return [][]string{{"Network usage", "no data", ""}}
+	}
+	return [][]string{
+		{"Network receive (rx)", formatMemory(usage.Receive), "per second"},
+		{"Network transmit (tx)", formatMemory(usage.Transmit), "per second"},
+	}
+}
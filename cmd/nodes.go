@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// nodeSelector restricts the nodes reported on to those whose labels match it, set by --node-selector
+var nodeSelector string
+
+// nodeLabelMatchers are the matchers on kube_node_labels that --node-selector translates to
+var nodeLabelMatchers []string
+
+// invalidLabelCharPattern matches the characters kube-state-metrics replaces with _ in the names of node labels
+var invalidLabelCharPattern = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// nodeCapacity compares the allocatable CPU of a node with the CPU requested by the pods scheduled on it
+type nodeCapacity struct {
+	Node          string  `json:"node"`
+	Allocatable   float64 `json:"allocatable"`   // Cores allocatable to pods
+	Requested     float64 `json:"requested"`     // Cores requested by the containers on the node
+	Free          float64 `json:"free"`          // Allocatable cores not requested yet
+	Unschedulable bool    `json:"unschedulable"` // Set when the node is cordoned
+}
+
+// nodesCmd represents the nodes command
+var nodesCmd = &cobra.Command{
+	Use:   "nodes",
+	Short: "Show the allocatable, requested and free CPU of every node",
+	Long: `Nodes compares the CPU allocatable on every node with the CPU requested by the
+containers scheduled on it, which shows how much room is left for new pods. Cordoned
+nodes are flagged since no new pods will be scheduled on them.
+
+--node-selector restricts the report to the nodes whose labels match a Kubernetes label
+selector. Node labels are read from kube_node_labels, so kube-state-metrics must expose
+the selected labels, e.g. with --metric-labels-allowlist=nodes=[*].`,
+	Example: `  k nodes
+  k nodes --node-selector node.kubernetes.io/instance-type=m5.xlarge
+  k nodes --node-selector 'topology.kubernetes.io/zone in (eu-west-1a,eu-west-1b),!gpu'`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		nodeLabelMatchers, err = parseNodeSelector(nodeSelector)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodes, err := queryNodeCapacity(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		if outputFormat == "json" {
+			return printJSON(nodes)
+		}
+		if len(nodes) == 0 {
+			if nodeSelector != "" {
+				fmt.Printf("No node allocatable data found for nodes matching %s (no matching nodes or node labels not exported by kube-state-metrics)\n", nodeSelector)
+				return nil
+			}
+			fmt.Println("No node allocatable data found (kube-state-metrics unavailable)")
+			return nil
+		}
+		if outputFormat == "table" {
+			printNodeCapacityTable(nodes)
+			return nil
+		}
+		printNodeCapacity(nodes)
+		return nil
+	},
+}
+
+// queryNodeCapacity returns the CPU capacity of every node reporting allocatable resources, ordered by node name
+func queryNodeCapacity(ctx context.Context) ([]nodeCapacity, error) {
+	allocatable, err := queryPrometheusVector(ctx, nodeCPUAllocatableQuery())
+	if err != nil {
+		return nil, fmt.Errorf("querying node allocatable CPU: %w", err)
+	}
+	requested, err := queryPrometheusVector(ctx, nodeCPURequestsQuery())
+	if err != nil {
+		return nil, fmt.Errorf("querying node CPU requests: %w", err)
+	}
+	unschedulable, err := queryPrometheusVector(ctx, nodeUnschedulableQuery())
+	if err != nil {
+		return nil, fmt.Errorf("querying unschedulable nodes: %w", err)
+	}
+
+	requestedByNode := map[string]float64{}
+	for _, sample := range requested {
+		requestedByNode[sample.Metric["node"]] = sample.Value
+	}
+	cordoned := map[string]bool{}
+	for _, sample := range unschedulable {
+		cordoned[sample.Metric["node"]] = true
+	}
+
+	nodes := make([]nodeCapacity, 0, len(allocatable))
+	for _, sample := range allocatable {
+		node := sample.Metric["node"]
+		nodes = append(nodes, nodeCapacity{
+			Node:          node,
+			Allocatable:   sample.Value,
+			Requested:     requestedByNode[node],
+			Free:          sample.Value - requestedByNode[node],
+			Unschedulable: cordoned[node],
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	return nodes, nil
+}
+
+// parseNodeSelector translates a Kubernetes label selector such as key=value,key2!=value2 into PromQL matchers on
+// the labels of kube_node_labels, where kube-state-metrics exports a node label as label_ followed by its name with
+// invalid characters replaced by _
+func parseNodeSelector(selector string) ([]string, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, nil
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node selector %q: %w", selector, err)
+	}
+	requirements, _ := parsed.Requirements()
+
+	matchers := make([]string, 0, len(requirements))
+	for _, requirement := range requirements {
+		name := "label_" + invalidLabelCharPattern.ReplaceAllString(requirement.Key(), "_")
+		values := requirement.Values().List()
+		var matcher string
+		switch requirement.Operator() {
+		case selection.Equals, selection.DoubleEquals:
+			matcher = fmt.Sprintf("%s=%s", name, strconv.Quote(values[0]))
+		case selection.NotEquals:
+			matcher = fmt.Sprintf("%s!=%s", name, strconv.Quote(values[0]))
+		case selection.In:
+			matcher = fmt.Sprintf("%s=~%s", name, strconv.Quote(regexAlternation(values)))
+		case selection.NotIn:
+			matcher = fmt.Sprintf("%s!~%s", name, strconv.Quote(regexAlternation(values)))
+		case selection.Exists:
+			matcher = fmt.Sprintf(`%s!=""`, name)
+		case selection.DoesNotExist:
+			matcher = fmt.Sprintf(`%s=""`, name)
+		default:
+			return nil, fmt.Errorf("invalid node selector %q: operator %s is not supported", selector, requirement.Operator())
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// regexAlternation returns a regular expression matching exactly one of the values
+func regexAlternation(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = regexp.QuoteMeta(value)
+	}
+	return strings.Join(quoted, "|")
+}
+
+// formatFreeCPU formats free CPU, which is zero or negative when a node is fully requested
+func formatFreeCPU(free float64) string {
+	if free <= 0 {
+		return "0"
+	}
+	return formatCPU(free)
+}
+
+// printNodeCapacity prints the CPU capacity of the nodes in text format
+func printNodeCapacity(nodes []nodeCapacity) {
+	fmt.Println("Node CPU capacity:")
+	for _, node := range nodes {
+		fmt.Printf("  %s:", node.Node)
+		if node.Unschedulable {
+			fmt.Print(" (cordoned)")
+		}
+		fmt.Println()
+		fmt.Printf("    Allocatable: %s\n", formatCPU(node.Allocatable))
+		fmt.Printf("    Requested:   %s\n", formatCPU(node.Requested))
+		fmt.Printf("    Free:        %s\n", formatFreeCPU(node.Free))
+	}
+}
+
+// printNodeCapacityTable prints the CPU capacity of the nodes as an aligned table
+func printNodeCapacityTable(nodes []nodeCapacity) {
+	rows := make([][]string, 0, len(nodes))
+	for _, node := range nodes {
+		status := "Ready"
+		if node.Unschedulable {
+			status = "Cordoned"
+		}
+		rows = append(rows, []string{
+			node.Node,
+			formatCPU(node.Allocatable),
+			formatCPU(node.Requested),
+			colorizeStatus(formatFreeCPU(node.Free), node.Free <= 0),
+			status,
+		})
+	}
+	fmt.Print(renderTable([]string{"NODE", "ALLOCATABLE", "REQUESTED", "FREE", "STATUS"}, rows))
+}
+
+func init() {
+	rootCmd.AddCommand(nodesCmd)
+
+	nodesCmd.Flags().StringVar(&nodeSelector, "node-selector", "", "Only report on the nodes matching this label selector, e.g. node.kubernetes.io/instance-type=m5.xlarge")
+}
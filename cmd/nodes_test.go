@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNodeSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		want     []string
+		wantErr  string
+	}{
+		{name: "empty", selector: " ", want: nil},
+		{name: "equals", selector: "pool=batch", want: []string{`label_pool="batch"`}},
+		{name: "double equals", selector: "pool==batch", want: []string{`label_pool="batch"`}},
+		{name: "not equals", selector: "pool!=batch", want: []string{`label_pool!="batch"`}},
+		{name: "in", selector: "zone in (eu-1a, eu-1b)", want: []string{`label_zone=~"eu-1a|eu-1b"`}},
+		{name: "notin", selector: "zone notin (eu-1a)", want: []string{`label_zone!~"eu-1a"`}},
+		{name: "exists", selector: "gpu", want: []string{`label_gpu!=""`}},
+		{name: "does not exist", selector: "!gpu", want: []string{`label_gpu=""`}},
+		{
+			name:     "key with prefix and dots",
+			selector: "node.kubernetes.io/instance-type=m5.large",
+			want:     []string{`label_node_kubernetes_io_instance_type="m5.large"`},
+		},
+		{name: "in values are regex escaped", selector: "type in (m5.large)", want: []string{`label_type=~"m5\\.large"`}},
+		{
+			name:     "several requirements",
+			selector: "pool=batch,!spot",
+			want:     []string{`label_pool="batch"`, `label_spot=""`},
+		},
+		{name: "malformed", selector: "pool=batch,=x", wantErr: `invalid node selector "pool=batch,=x"`},
+		{name: "unsupported operator", selector: "cores>4", wantErr: "operator gt is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNodeSelector(tt.selector)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNodeSelector(%q) = %q, want %q", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
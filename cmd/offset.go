@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	// evaluationOffset shifts the evaluation of queries that would run at the current time into the past, set by
+	// --eval-offset
+	evaluationOffset time.Duration
+	// evaluationInstant is the current time shifted by --eval-offset, captured once at the start of the run so that
+	// all its queries evaluate at the same instant, however long the run takes
+	evaluationInstant time.Time
+)
+
+// startEvaluationOffset validates --eval-offset and captures the evaluation instant of the run
+func startEvaluationOffset() error {
+	if evaluationOffset < 0 {
+		return fmt.Errorf("invalid evaluation offset %s: must not be negative", evaluationOffset)
+	}
+	captureEvaluationInstant()
+	return nil
+}
+
+// captureEvaluationInstant fixes the instant queries about the present are evaluated at to the current time, minus
+// --eval-offset
+func captureEvaluationInstant() {
+	evaluationInstant = time.Now().Add(-evaluationOffset)
+}
+
+// evaluationNow returns the time queries about the present are evaluated at: the instant captured at the start of the
+// run. Relative times such as --at -2h and --since -6h are relative to it.
+func evaluationNow() time.Time {
+	if evaluationInstant.IsZero() {
+		return time.Now().Add(-evaluationOffset)
+	}
+	return evaluationInstant
+}
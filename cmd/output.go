@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	// yamlOutputAnnotation marks the commands that support the yaml output format
+	yamlOutputAnnotation = "yaml-output"
+	// prometheusOutputAnnotation marks the commands that support the prometheus exposition output format
+	prometheusOutputAnnotation = "prometheus-output"
+	// csvOutputAnnotation marks the commands that support the csv output format
+	csvOutputAnnotation = "csv-output"
+)
+
+// commandOutputAnnotations maps the output formats only some commands support to the annotation marking them
+var commandOutputAnnotations = map[string]string{
+	"yaml":       yamlOutputAnnotation,
+	"prometheus": prometheusOutputAnnotation,
+	"csv":        csvOutputAnnotation,
+}
+
+// defaultOutputFormat returns table for interactive terminals and text otherwise
+func defaultOutputFormat() string {
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		return "table"
+	}
+	return "text"
+}
+
+// validateOutput checks that the requested output format is supported by the command
+func validateOutput(cmd *cobra.Command, format string) error {
+	switch format {
+	case "text", "table", "json":
+		return nil
+	}
+	if annotation, ok := commandOutputAnnotations[format]; ok {
+		if _, ok := cmd.Annotations[annotation]; ok {
+			return nil
+		}
+		return fmt.Errorf("output format %s is not supported by the %s command", format, cmd.Name())
+	}
+	return fmt.Errorf("invalid output format %q: must be one of text, table, json, yaml, prometheus, csv", format)
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// tableColumnPadding is the number of spaces between two columns of a table
+const tableColumnPadding = 3
+
+// renderTable renders rows below a header row with the columns aligned. Cells may be colored with colorize, which
+// doesn't count towards the width of their column.
+func renderTable(headers []string, rows [][]string) string {
+	lines := append([][]string{headers}, rows...)
+	var widths []int
+	for _, line := range lines {
+		for i, cell := range line {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if width := visibleWidth(cell); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		for i, cell := range line {
+			b.WriteString(cell)
+			// Like tabwriter, the last cell of a line is not padded
+			if i < len(line)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-visibleWidth(cell)+tableColumnPadding))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	outputFile   string // File the report is written to instead of stdout, set by --output-file
+	appendOutput bool   // Append the report to --output-file instead of replacing it, set by --append
+	// outputTemp is the temporary file the report is written to, renamed to outputFile once the command succeeded
+	outputTemp *os.File
+)
+
+// startOutputFile redirects the report to a temporary file next to --output-file, creating its directory. Diagnostic
+// messages still go to stderr. With --append the temporary file starts with the current content of the file.
+func startOutputFile() error {
+	if outputFile == "" || dryRun {
+		return nil
+	}
+	dir := filepath.Dir(outputFile)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(outputFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	if err := os.Chmod(temp.Name(), 0o644); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	if appendOutput {
+		if err := copyFileInto(temp, outputFile); err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+			return fmt.Errorf("appending to output file: %w", err)
+		}
+	}
+	outputTemp = temp
+	os.Stdout = temp
+	return nil
+}
+
+// copyFileInto copies the content of the file at path into w, copying nothing if the file doesn't exist
+func copyFileInto(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// finishOutputFile moves the report written with --output-file into place, so that the file is never left holding
+// a partial report. When keep is false, because the command failed, the report is dropped and the file is unchanged.
+func finishOutputFile(keep bool) error {
+	if outputTemp == nil {
+		return nil
+	}
+	closeErr := outputTemp.Close()
+	if !keep {
+		os.Remove(outputTemp.Name())
+		return nil
+	}
+	if closeErr != nil {
+		os.Remove(outputTemp.Name())
+		return fmt.Errorf("writing output file: %w", closeErr)
+	}
+	if err := os.Rename(outputTemp.Name(), outputFile); err != nil {
+		os.Remove(outputTemp.Name())
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return nil
+}
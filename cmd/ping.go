@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// pingCmd represents the ping command
+var pingCmd = &cobra.Command{
+	Use:   "ping",
+	Short: "Check that Prometheus is reachable and healthy",
+	Long: `Ping calls the Prometheus health endpoint using the configured URL, credentials and TLS
+settings. It exits with status 0 when Prometheus is healthy and 1 otherwise, which makes it
+usable as a readiness gate in scripts and CI pipelines.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		endpoint, err := pingPrometheus(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("prometheus at %s is not healthy: %w", redactURL(endpoint), err)
+		}
+		fmt.Printf("Prometheus at %s is healthy\n", redactURL(endpoint))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pingCmd)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// profile is the config file profile whose settings override the top-level ones, set by --profile
+var profile string
+
+// applyProfile merges the settings of the selected profile of the config file over the top-level ones, so that a
+// profile only needs the keys that differ. Flags and the environment still take precedence.
+func applyProfile(v *viper.Viper) error {
+	if profile == "" {
+		return nil
+	}
+	if v.ConfigFileUsed() == "" {
+		return fmt.Errorf("profile %q selected but no config file was found", profile)
+	}
+	profiles := v.GetStringMap("profiles")
+	settings, ok := profiles[strings.ToLower(profile)].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("profile %q not found in config file %s, %s", profile, v.ConfigFileUsed(), describeProfiles(profiles))
+	}
+	return v.MergeConfigMap(settings)
+}
+
+// describeProfiles lists the profiles available in the config file for an error message
+func describeProfiles(profiles map[string]interface{}) string {
+	if len(profiles) == 0 {
+		return "which defines no profiles"
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "available profiles: " + strings.Join(names, ", ")
+}
+
+// profileKeySuffix returns the key a profile setting overrides, e.g. prometheus.url for profiles.prod.prometheus.url
+func profileKeySuffix(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, "profiles.")
+	if !ok {
+		return "", false
+	}
+	_, suffix, ok := strings.Cut(rest, ".")
+	return suffix, ok
+}
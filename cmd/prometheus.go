@@ -0,0 +1,852 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// maxRangeQueryPoints is the most points per series Prometheus returns for a range query by default
+const maxRangeQueryPoints = 11000
+
+// initialRetryBackoff is the delay before the first retry of a failed Prometheus query; it doubles on every retry
+const initialRetryBackoff = 500 * time.Millisecond
+
+// prometheusHTTPClient is the HTTP client used for every Prometheus request
+var prometheusHTTPClient = http.DefaultClient
+
+var (
+	strictWarnings bool // Fail queries for which Prometheus returns warnings, set by --strict
+	// strictWarningSeen records that --strict failed a query, so that the run fails even where a command
+	// reports the query error and carries on with the other queries
+	strictWarningSeen atomic.Bool
+)
+
+var (
+	errPrometheusURLScheme = errors.New("scheme must be http or https")
+	errPrometheusURLHost   = errors.New("host is missing")
+	errPrometheusURLQuery  = errors.New("query string and fragment are not allowed, API paths are appended to the URL")
+)
+
+// validatePrometheusURL checks that the Prometheus URL is an absolute http or https URL without a query string
+func validatePrometheusURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid prometheus URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid prometheus URL %q: %w", raw, errPrometheusURLScheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid prometheus URL %q: %w", raw, errPrometheusURLHost)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid prometheus URL %q: %w", raw, errPrometheusURLQuery)
+	}
+	return nil
+}
+
+// prometheusProxy returns the proxy function of the Prometheus transport: the proxy set with prometheus.proxy_url,
+// or else the one from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+func prometheusProxy() (func(*http.Request) (*url.URL, error), error) {
+	raw := viper.GetString("prometheus.proxy_url")
+	if raw == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prometheus proxy URL %q: %w", redactURL(raw), err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid prometheus proxy URL %q: scheme must be http, https or socks5", redactURL(raw))
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid prometheus proxy URL %q: %w", redactURL(raw), errPrometheusURLHost)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// authRoundTripper adds bearer token or basic auth credentials to every Prometheus request
+type authRoundTripper struct {
+	bearerToken     string
+	bearerTokenFile string
+	username        string
+	password        string
+	next            http.RoundTripper
+}
+
+// RoundTrip sets the Authorization header on a copy of the request before sending it
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	switch {
+	case rt.bearerTokenFile != "":
+		// Read the token on every request so rotated projected service account tokens are picked up
+		token, err := os.ReadFile(rt.bearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading bearer token file: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	case rt.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+rt.bearerToken)
+	case rt.username != "":
+		req.SetBasicAuth(rt.username, rt.password)
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// tenantHeader is the header Cortex, Mimir and Thanos use to select the tenant of a multi-tenant setup
+const tenantHeader = "X-Scope-OrgID"
+
+// headerRoundTripper adds fixed headers, such as the tenant of a multi-tenant Prometheus, to every request
+type headerRoundTripper struct {
+	headers http.Header
+	next    http.RoundTripper
+}
+
+// RoundTrip sets the headers on a copy of the request before sending it
+func (rt *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range rt.headers {
+		req.Header[name] = values
+	}
+	return rt.next.RoundTrip(req)
+}
+
+// prometheusHeaders returns the headers from prometheus.headers, with the tenant from prometheus.tenant
+func prometheusHeaders() http.Header {
+	headers := http.Header{}
+	for name, value := range viper.GetStringMapString("prometheus.headers") {
+		headers.Set(name, value)
+	}
+	if tenant := viper.GetString("prometheus.tenant"); tenant != "" {
+		// Set directly rather than with Set, which would canonicalize the name to X-Scope-Orgid
+		headers.Del(tenantHeader)
+		headers[tenantHeader] = []string{tenant}
+	}
+	return headers
+}
+
+// configurePrometheusClient validates the Prometheus URL and builds the HTTP client from the prometheus.* config keys
+func configurePrometheusClient() error {
+	for i, endpoint := range prometheusEndpoints {
+		if err := validatePrometheusURL(endpoint); err != nil {
+			return err
+		}
+		// API paths are appended to the URL, so a trailing slash would double up
+		prometheusEndpoints[i] = strings.TrimRight(endpoint, "/")
+	}
+	prometheusURL = prometheusEndpoints[0]
+
+	auth := &authRoundTripper{
+		bearerToken:     viper.GetString("prometheus.bearer_token"),
+		bearerTokenFile: viper.GetString("prometheus.bearer_token_file"),
+		username:        viper.GetString("prometheus.username"),
+		password:        viper.GetString("prometheus.password"),
+	}
+
+	if auth.bearerToken != "" && auth.bearerTokenFile != "" {
+		return fmt.Errorf("prometheus.bearer_token and prometheus.bearer_token_file are mutually exclusive")
+	}
+	if (auth.bearerToken != "" || auth.bearerTokenFile != "") && auth.username != "" {
+		return fmt.Errorf("prometheus bearer token and basic auth credentials are mutually exclusive")
+	}
+
+	tlsConfig, err := prometheusTLSConfig()
+	if err != nil {
+		return err
+	}
+	proxy, err := prometheusProxy()
+	if err != nil {
+		return err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+	auth.next = &headerRoundTripper{headers: prometheusHeaders(), next: transport}
+
+	prometheusHTTPClient = &http.Client{Transport: auth}
+	return nil
+}
+
+// prometheusTLSConfig builds the TLS configuration from the prometheus.tls.* config keys
+func prometheusTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: viper.GetBool("prometheus.tls.insecure_skip_verify"),
+	}
+	if tlsConfig.InsecureSkipVerify {
+		fmt.Fprintln(os.Stderr, "Warning: TLS certificate verification is disabled for Prometheus")
+	}
+
+	// Trust an internal CA in addition to the system roots
+	if caFile := viper.GetString("prometheus.tls.ca_file"); caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading prometheus CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in prometheus CA file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Present a client certificate when both halves of the key pair are configured
+	certFile := viper.GetString("prometheus.tls.cert_file")
+	keyFile := viper.GetString("prometheus.tls.key_file")
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("prometheus.tls.cert_file and prometheus.tls.key_file must be set together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading prometheus client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// pingPrometheus checks that Prometheus is reachable with the configured credentials and reports itself healthy.
+// It returns the URL of the endpoint that answered, or the URLs of all of them when none could be reached.
+func pingPrometheus(ctx context.Context) (string, error) {
+	if dryRun {
+		printDryRunRequest("GET " + redactURL(prometheusURL+"/-/healthy"))
+		return prometheusURL, nil
+	}
+
+	var answered string
+	err := withPrometheusFailover(ctx, func(endpoint string) error {
+		answered = endpoint
+		return pingPrometheusEndpoint(ctx, endpoint)
+	})
+	if errors.Is(err, errAllEndpointsFailed) {
+		answered = strings.Join(prometheusEndpoints, ", ")
+	}
+	return answered, err
+}
+
+// pingPrometheusEndpoint checks that a single Prometheus endpoint is reachable and reports itself healthy
+func pingPrometheusEndpoint(ctx context.Context, endpoint string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/-/healthy", nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := prometheusHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received non-OK HTTP status: %s", resp.Status)
+	}
+	return nil
+}
+
+// queryPrometheusMetric runs an instant query and returns the value of the first result.
+// The boolean is false when the query failed or returned no data.
+func queryPrometheusMetric(ctx context.Context, query string) (float64, bool) {
+	samples, err := queryPrometheusVector(ctx, query)
+	if err != nil {
+		// An interrupt is reported once when the command exits rather than for every query
+		if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Error querying Prometheus: %v\n", err)
+		}
+		return 0, false
+	}
+	if len(samples) == 0 {
+		return 0, false
+	}
+	return samples[0].Value, true
+}
+
+// batchQueryLabel is the label queryPrometheusBatch tells the results of its queries apart with
+const batchQueryLabel = "k8s_capacity_query"
+
+// queryPrometheusBatch runs several instant queries in a single round-trip, joined with or and each tagged with
+// batchQueryLabel set to its key, and returns the value of the first sample of every query that returned data.
+// A failure fails all the queries; queryPrometheusEach tells which of them failed.
+func queryPrometheusBatch(ctx context.Context, queries map[string]string) (map[string]float64, error) {
+	keys := make([]string, 0, len(queries))
+	for key := range queries {
+		keys = append(keys, key)
+	}
+	// A stable order keeps the batched query identical between runs, for the cache and --dry-run
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf(`label_replace(%s, %q, %q, "", "")`, queries[key], batchQueryLabel, key))
+	}
+
+	values := map[string]float64{}
+	if len(parts) == 0 {
+		return values, nil
+	}
+	samples, err := queryPrometheusVector(ctx, strings.Join(parts, " or "))
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range samples {
+		key := sample.Metric[batchQueryLabel]
+		if _, seen := values[key]; !seen {
+			values[key] = sample.Value
+		}
+	}
+	return values, nil
+}
+
+// queryPrometheusEach runs instant queries one at a time and returns the value of the first sample of every query
+// that returned data, and the error of every query that failed, by key.
+func queryPrometheusEach(ctx context.Context, queries map[string]string) (map[string]float64, map[string]error) {
+	values := map[string]float64{}
+	errs := map[string]error{}
+	for key, query := range queries {
+		samples, err := queryPrometheusVector(ctx, query)
+		if err != nil {
+			logger.Debug("Query failed", "query", key, "error", err)
+			errs[key] = err
+			continue
+		}
+		if len(samples) > 0 {
+			values[key] = samples[0].Value
+		}
+	}
+	return values, errs
+}
+
+// errNoData is returned by queryPrometheusValue when the query returned an empty vector
+var errNoData = errors.New("query returned no data")
+
+// queryPrometheusValue runs an instant query expected to return a single sample, such as a sum(), and returns its value.
+// It returns errNoData for an empty result and an error for a result with more than one sample.
+func queryPrometheusValue(ctx context.Context, query string) (float64, error) {
+	return queryPrometheusValueAt(ctx, query, time.Time{})
+}
+
+// queryPrometheusValueAt is queryPrometheusValue evaluated at ts, or at the current time if ts is zero
+func queryPrometheusValueAt(ctx context.Context, query string, ts time.Time) (float64, error) {
+	samples, err := queryPrometheusVectorAt(ctx, query, ts)
+	if err != nil {
+		return 0, err
+	}
+	switch len(samples) {
+	case 0:
+		return 0, errNoData
+	case 1:
+		return samples[0].Value, nil
+	}
+	return 0, fmt.Errorf("expected a single sample but the query returned %d", len(samples))
+}
+
+// prometheusVectorSample is one element of an instant query result
+type prometheusVectorSample struct {
+	Metric    map[string]string
+	Timestamp time.Time
+	Value     float64
+}
+
+// queryPrometheusVector runs an instant query and returns every sample of the resulting vector
+func queryPrometheusVector(ctx context.Context, query string) ([]prometheusVectorSample, error) {
+	return queryPrometheusVectorAt(ctx, query, time.Time{})
+}
+
+// queryPrometheusVectorAt runs an instant query evaluated at ts, or at the current time if ts is zero,
+// and returns every sample of the resulting vector
+func queryPrometheusVectorAt(ctx context.Context, query string, ts time.Time) ([]prometheusVectorSample, error) {
+	resultType, result, err := queryPrometheusInstantAt(ctx, query, ts)
+	if err != nil {
+		return nil, err
+	}
+	if resultType != "vector" {
+		return nil, fmt.Errorf("unexpected result type %q for instant query", resultType)
+	}
+
+	var results []struct {
+		Metric map[string]string `json:"metric"`
+		Value  []interface{}     `json:"value"`
+	}
+	if err := json.Unmarshal(result, &results); err != nil {
+		return nil, fmt.Errorf("parsing Prometheus response: %w", err)
+	}
+
+	samples := make([]prometheusVectorSample, 0, len(results))
+	for _, r := range results {
+		timestamp, value, err := parseSamplePair(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, prometheusVectorSample{Metric: r.Metric, Timestamp: timestamp, Value: value})
+	}
+
+	return samples, nil
+}
+
+// queryPrometheusInstantAt runs an instant query evaluated at ts, or at the current time if ts is zero, and returns
+// the type and the undecoded result, which can be a vector, a matrix, a scalar or a string depending on the expression.
+// With --eval-offset the current time is shifted into the past.
+func queryPrometheusInstantAt(ctx context.Context, query string, ts time.Time) (string, json.RawMessage, error) {
+	// Queries about the present all evaluate at the instant captured at the start of the run, which also keeps
+	// identical queries of the run identical and cacheable
+	explicit := !ts.IsZero() || evaluationOffset > 0
+	if ts.IsZero() {
+		ts = evaluationNow()
+	}
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("time", strconv.FormatFloat(float64(ts.UnixMilli())/1000, 'f', -1, 64))
+
+	// Construct the full URL for the Prometheus API
+	fullURL := fmt.Sprintf("%s/api/v1/query?%s", prometheusURL, params.Encode())
+
+	evaluationTime := ts.Format(time.RFC3339)
+	logger.Debug("Running Prometheus query", "query", query, "evaluationTime", evaluationTime, "url", redactURL(fullURL))
+
+	if dryRun {
+		comment := ""
+		if explicit {
+			comment = "# evaluated at " + evaluationTime + "\n"
+		}
+		printDryRunRequest(comment + query)
+		return "vector", json.RawMessage("[]"), nil
+	}
+
+	body, err := fetchPrometheus(ctx, fullURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Unmarshal the JSON response
+	var result struct {
+		Status    string   `json:"status"`
+		ErrorType string   `json:"errorType"`
+		Error     string   `json:"error"`
+		Warnings  []string `json:"warnings"`
+		Data      struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", nil, fmt.Errorf("parsing Prometheus response: %w", err)
+	}
+	if result.Status != "success" {
+		return "", nil, fmt.Errorf("prometheus query failed: %s", formatPrometheusError(result.ErrorType, result.Error))
+	}
+	if err := checkPrometheusWarnings(query, result.Warnings); err != nil {
+		return "", nil, err
+	}
+
+	return result.Data.ResultType, result.Data.Result, nil
+}
+
+// checkPrometheusWarnings reports the warnings Prometheus returned for a query, e.g. about partial results, on stderr.
+// With --strict they are returned as an error instead, so that no decision is made on truncated data.
+func checkPrometheusWarnings(query string, warnings []string) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+	if strictWarnings {
+		strictWarningSeen.Store(true)
+		return fmt.Errorf("prometheus returned warnings for query %s: %s", query, strings.Join(warnings, "; "))
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: Prometheus returned a warning for query %s: %s\n", query, warning)
+	}
+	return nil
+}
+
+// prometheusSample is a single timestamped value of a series
+type prometheusSample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// prometheusSeries is one series of a range query result
+type prometheusSeries struct {
+	Metric  map[string]string
+	Samples []prometheusSample
+}
+
+// queryPrometheusRange runs a range query and returns every series of the resulting matrix
+func queryPrometheusRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]prometheusSeries, error) {
+	if step <= 0 || step%time.Millisecond != 0 {
+		return nil, fmt.Errorf("invalid step %s: must be a positive whole number of milliseconds", step)
+	}
+	// Prometheus rejects range queries with too many points, check up front for a clearer error
+	points := int64(end.Sub(start)/step) + 1
+	if points > maxRangeQueryPoints {
+		minStep := end.Sub(start) / (maxRangeQueryPoints - 1)
+		minStep = (minStep + time.Second - 1).Truncate(time.Second) // Round up to whole seconds
+		return nil, fmt.Errorf("step %s over %s gives %d points, more than the %d Prometheus allows: use a step of at least %s",
+			formatPrometheusDuration(step), formatPrometheusDuration(end.Sub(start).Round(time.Second)), points, maxRangeQueryPoints, formatPrometheusDuration(minStep))
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", fmt.Sprintf("%d", start.Unix()))
+	params.Set("end", fmt.Sprintf("%d", end.Unix()))
+	params.Set("step", formatPrometheusDuration(step))
+
+	// Construct the full URL for the Prometheus range query API
+	fullURL := fmt.Sprintf("%s/api/v1/query_range?%s", prometheusURL, params.Encode())
+
+	logger.Debug("Running Prometheus range query", "query", query,
+		"start", start.Format(time.RFC3339), "end", end.Format(time.RFC3339), "step", formatPrometheusDuration(step), "points", points, "url", redactURL(fullURL))
+
+	if dryRun {
+		printDryRunRequest(fmt.Sprintf("# range from %s to %s, step %s\n%s",
+			start.Format(time.RFC3339), end.Format(time.RFC3339), formatPrometheusDuration(step), query))
+		return nil, nil
+	}
+
+	body, err := fetchPrometheus(ctx, fullURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the JSON response
+	var result struct {
+		Status    string   `json:"status"`
+		ErrorType string   `json:"errorType"`
+		Error     string   `json:"error"`
+		Warnings  []string `json:"warnings"`
+		Data      struct {
+			ResultType string `json:"resultType"`
+			Results    []struct {
+				Metric map[string]string `json:"metric"`
+				Values [][]interface{}   `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parsing Prometheus response: %w", err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %s", formatPrometheusError(result.ErrorType, result.Error))
+	}
+	if err := checkPrometheusWarnings(query, result.Warnings); err != nil {
+		return nil, err
+	}
+	if result.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("unexpected result type %q for range query", result.Data.ResultType)
+	}
+
+	series := make([]prometheusSeries, 0, len(result.Data.Results))
+	for _, r := range result.Data.Results {
+		s := prometheusSeries{Metric: r.Metric}
+		for _, pair := range r.Values {
+			timestamp, value, err := parseSamplePair(pair)
+			if err != nil {
+				return nil, err
+			}
+			s.Samples = append(s.Samples, prometheusSample{Timestamp: timestamp, Value: value})
+		}
+		series = append(series, s)
+	}
+
+	// Only ranges reaching the present are expected to have recent samples. The last step of the range can end
+	// up to a step before end, so the age is measured from there.
+	if now := evaluationNow(); now.Sub(end) < maxStaleness {
+		warnIfStale("sample of the range query", lastSamples(series), now.Add(-step))
+	}
+	return series, nil
+}
+
+// querySeries returns the label sets of the series matching any of the series selectors between start and end, using
+// the series API which, unlike a query, doesn't load any sample
+func querySeries(ctx context.Context, matchers []string, start, end time.Time) ([]map[string]string, error) {
+	params := url.Values{}
+	for _, matcher := range matchers {
+		params.Add("match[]", matcher)
+	}
+	params.Set("start", fmt.Sprintf("%d", start.Unix()))
+	params.Set("end", fmt.Sprintf("%d", end.Unix()))
+
+	fullURL := fmt.Sprintf("%s/api/v1/series?%s", prometheusURL, params.Encode())
+
+	logger.Debug("Running Prometheus series query", "matchers", matchers,
+		"start", start.Format(time.RFC3339), "end", end.Format(time.RFC3339), "url", redactURL(fullURL))
+
+	if dryRun {
+		printDryRunRequest(fmt.Sprintf("# series from %s to %s\n%s",
+			start.Format(time.RFC3339), end.Format(time.RFC3339), strings.Join(matchers, "\n")))
+		return nil, nil
+	}
+
+	body, err := fetchPrometheus(ctx, fullURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Status    string              `json:"status"`
+		ErrorType string              `json:"errorType"`
+		Error     string              `json:"error"`
+		Warnings  []string            `json:"warnings"`
+		Data      []map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parsing Prometheus response: %w", err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus series query failed: %s", formatPrometheusError(result.ErrorType, result.Error))
+	}
+	if err := checkPrometheusWarnings(strings.Join(matchers, ", "), result.Warnings); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// queryLabelValues returns the values of a label across the series matching any of the series selectors between start
+// and end, or across all series when there are no selectors
+func queryLabelValues(ctx context.Context, label string, matchers []string, start, end time.Time) ([]string, error) {
+	params := url.Values{}
+	for _, matcher := range matchers {
+		params.Add("match[]", matcher)
+	}
+	params.Set("start", fmt.Sprintf("%d", start.Unix()))
+	params.Set("end", fmt.Sprintf("%d", end.Unix()))
+
+	fullURL := fmt.Sprintf("%s/api/v1/label/%s/values?%s", prometheusURL, url.PathEscape(label), params.Encode())
+
+	logger.Debug("Running Prometheus label values query", "label", label, "matchers", matchers,
+		"start", start.Format(time.RFC3339), "end", end.Format(time.RFC3339), "url", redactURL(fullURL))
+
+	if dryRun {
+		printDryRunRequest(fmt.Sprintf("# values of label %s from %s to %s\n%s",
+			label, start.Format(time.RFC3339), end.Format(time.RFC3339), strings.Join(matchers, "\n")))
+		return nil, nil
+	}
+
+	body, err := fetchPrometheus(ctx, fullURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Status    string   `json:"status"`
+		ErrorType string   `json:"errorType"`
+		Error     string   `json:"error"`
+		Warnings  []string `json:"warnings"`
+		Data      []string `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parsing Prometheus response: %w", err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus label values query failed: %s", formatPrometheusError(result.ErrorType, result.Error))
+	}
+	if err := checkPrometheusWarnings("values of label "+label, result.Warnings); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// parseSamplePair converts a [timestamp, value] pair from the Prometheus API
+func parseSamplePair(pair []interface{}) (time.Time, float64, error) {
+	if len(pair) != 2 {
+		return time.Time{}, 0, fmt.Errorf("malformed sample %v", pair)
+	}
+	timestamp, ok := pair[0].(float64)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("unexpected timestamp type: %T", pair[0])
+	}
+	value, err := parseSampleValue(pair[1])
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("converting Prometheus value to float: %w", err)
+	}
+	return time.Unix(0, int64(timestamp*float64(time.Second))), value, nil
+}
+
+// parseSampleValue converts a sample value from the Prometheus API, which is encoded as a string, to a float
+func parseSampleValue(value interface{}) (float64, error) {
+	var floatValue float64
+	switch v := value.(type) {
+	case string:
+		if _, err := fmt.Sscanf(v, "%f", &floatValue); err != nil {
+			return 0, err
+		}
+	case float64:
+		floatValue = v
+	default:
+		return 0, fmt.Errorf("unexpected value type: %T", v)
+	}
+	return floatValue, nil
+}
+
+// fetchPrometheus sends a GET request to the Prometheus API and returns the response body.
+// Network errors and 5xx responses are retried up to maxRetries times with exponential backoff.
+// Successful responses are reused for identical requests within cacheTTL.
+// A context that is already done fails immediately, without consulting the cache.
+func fetchPrometheus(ctx context.Context, fullURL string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cacheTTL > 0 {
+		if body, ok := cachedPrometheusResponse(fullURL); ok {
+			logger.Debug("Using cached Prometheus response", "url", redactURL(fullURL))
+			return body, nil
+		}
+	}
+
+	backoff := initialRetryBackoff
+	for attempt := 0; ; attempt++ {
+		body, retryable, err := fetchPrometheusFromEndpoints(ctx, fullURL)
+		if err == nil && cacheTTL > 0 {
+			cachePrometheusResponse(fullURL, body)
+		}
+		// Failures caused by an interrupt are not worth retrying
+		if err == nil || !retryable || attempt >= maxRetries || ctx.Err() != nil {
+			return body, err
+		}
+
+		// Waiting out a backoff that ends after the caller's deadline would only delay the same failure
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return nil, err
+		}
+
+		logger.Debug("Retrying Prometheus query", "backoff", backoff, "attempt", attempt+1, "maxRetries", maxRetries, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// fetchPrometheusFromEndpoints sends a GET request for fullURL, which is built with prometheusURL, to the first
+// reachable Prometheus endpoint
+func fetchPrometheusFromEndpoints(ctx context.Context, fullURL string) (body []byte, retryable bool, err error) {
+	path := strings.TrimPrefix(fullURL, prometheusURL)
+	err = withPrometheusFailover(ctx, func(endpoint string) error {
+		var fetchErr error
+		body, retryable, fetchErr = fetchPrometheusOnce(ctx, endpoint+path)
+		return fetchErr
+	})
+	return body, retryable, err
+}
+
+// fetchPrometheusOnce sends a single GET request to the Prometheus API and reports whether a failure is worth retrying
+func fetchPrometheusOnce(ctx context.Context, fullURL string) (body []byte, retryable bool, err error) {
+	// Bound the request by the configured query timeout, or by the caller's deadline when it is sooner
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("creating request: %w", err)
+	}
+
+	// Time the request until the whole body is read, failed requests included
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start)
+		recordQueryDuration(duration)
+		logger.Debug("Prometheus request finished", "duration", duration)
+	}()
+
+	// Send the HTTP GET request to Prometheus
+	resp, err := prometheusHTTPClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	logger.Debug("Received Prometheus response", "status", resp.Status)
+
+	// Check if the response status is not 200 OK; only server errors are transient
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode >= http.StatusInternalServerError, newPrometheusHTTPError(resp)
+	}
+
+	// Read the response body
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("reading response body: %w", err)
+	}
+
+	logger.Debug("Read Prometheus response body", "body", string(body))
+	return body, false, nil
+}
+
+// maxErrorBodySize bounds how much of a failed response is read for the Prometheus error message
+const maxErrorBodySize = 64 << 10
+
+// prometheusHTTPError is a non-OK response from Prometheus, with the error type and message of its body when it is
+// a Prometheus API error rather than, e.g., the page of a proxy in front of it
+type prometheusHTTPError struct {
+	statusCode int
+	status     string // e.g. 401 Unauthorized
+	errorType  string // e.g. bad_data, timeout or unavailable
+	message    string
+}
+
+// newPrometheusHTTPError reads the error of a non-OK response
+func newPrometheusHTTPError(resp *http.Response) *prometheusHTTPError {
+	httpErr := &prometheusHTTPError{statusCode: resp.StatusCode, status: resp.Status}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return httpErr
+	}
+	var apiErr struct {
+		ErrorType string `json:"errorType"`
+		Error     string `json:"error"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil {
+		httpErr.errorType, httpErr.message = apiErr.ErrorType, apiErr.Error
+	}
+	return httpErr
+}
+
+func (e *prometheusHTTPError) Error() string {
+	msg := "received non-OK HTTP status: " + e.status
+	if detail := formatPrometheusError(e.errorType, e.message); detail != "" {
+		msg += ": " + detail
+	}
+	switch e.statusCode {
+	case http.StatusUnauthorized:
+		msg += " (check the bearer token or basic auth credentials)"
+	case http.StatusForbidden:
+		msg += " (the credentials are not allowed to query this Prometheus or tenant)"
+	}
+	return msg
+}
+
+// formatPrometheusError joins the error type and message of a Prometheus API error, either of which may be empty
+func formatPrometheusError(errorType, message string) string {
+	switch {
+	case errorType == "":
+		return message
+	case message == "":
+		return errorType
+	}
+	return errorType + ": " + message
+}
@@ -0,0 +1,435 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// usePrometheus points the Prometheus client at url for the duration of the test, restoring the settings of the run
+// afterwards
+func usePrometheus(t *testing.T, url string) {
+	t.Helper()
+	savedURL, savedEndpoints, savedClient := prometheusURL, prometheusEndpoints, prometheusHTTPClient
+	savedTimeout, savedRetries, savedCacheTTL := queryTimeout, maxRetries, cacheTTL
+	savedStrict, savedDryRun := strictWarnings, dryRun
+	t.Cleanup(func() {
+		prometheusURL, prometheusEndpoints, prometheusHTTPClient = savedURL, savedEndpoints, savedClient
+		queryTimeout, maxRetries, cacheTTL = savedTimeout, savedRetries, savedCacheTTL
+		strictWarnings, dryRun = savedStrict, savedDryRun
+		strictWarningSeen.Store(false)
+		activeEndpoint.Store(0)
+	})
+
+	prometheusURL = url
+	prometheusEndpoints = []string{url}
+	prometheusHTTPClient = http.DefaultClient
+	queryTimeout = 5 * time.Second
+	maxRetries = 0
+	cacheTTL = 0
+	strictWarnings = false
+	dryRun = false
+	activeEndpoint.Store(0)
+}
+
+// newPrometheusStub starts a server answering every request with handler and points the Prometheus client at it
+func newPrometheusStub(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	usePrometheus(t, server.URL)
+	return server
+}
+
+// respondWith returns a handler answering every request with status and body
+func respondWith(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}
+}
+
+// captureStderr returns what fn writes to stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = saved }()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+	fn()
+	w.Close()
+	return <-output
+}
+
+func TestQueryPrometheusVector(t *testing.T) {
+	var gotPath, gotQuery string
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.Query().Get("query")
+		respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"namespace":"a"},"value":[1700000000,"0.25"]},
+			{"metric":{"namespace":"b"},"value":[1700000000.5,"2"]}]}}`)(w, r)
+	})
+
+	samples, err := queryPrometheusVector(context.Background(), `sum by (namespace) (up)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotPath != "/api/v1/query" || gotQuery != `sum by (namespace) (up)` {
+		t.Errorf("request = %s?query=%s, want /api/v1/query?query=sum by (namespace) (up)", gotPath, gotQuery)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(samples))
+	}
+	if samples[0].Metric["namespace"] != "a" || samples[0].Value != 0.25 || !samples[0].Timestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("first sample = %+v", samples[0])
+	}
+	if samples[1].Metric["namespace"] != "b" || samples[1].Value != 2 || !samples[1].Timestamp.Equal(time.Unix(1700000000, 5e8)) {
+		t.Errorf("second sample = %+v", samples[1])
+	}
+}
+
+// warningResponse is a successful response carrying a warning about partial data
+const warningResponse = `{"status":"success","warnings":["partial data"],"data":{"resultType":"vector","result":[
+	{"metric":{},"value":[1700000000,"1"]}]}}`
+
+func TestQueryPrometheusVectorWarnings(t *testing.T) {
+	newPrometheusStub(t, respondWith(http.StatusOK, warningResponse))
+
+	var samples []prometheusVectorSample
+	var err error
+	stderr := captureStderr(t, func() {
+		samples, err = queryPrometheusVector(context.Background(), "up")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 1 {
+		t.Errorf("got %d samples, want 1", len(samples))
+	}
+	if want := "Warning: Prometheus returned a warning for query up: partial data"; !strings.Contains(stderr, want) {
+		t.Errorf("stderr = %q, want it to contain %q", stderr, want)
+	}
+}
+
+func TestQueryPrometheusVectorStrictWarnings(t *testing.T) {
+	newPrometheusStub(t, respondWith(http.StatusOK, warningResponse))
+	strictWarnings = true
+
+	var err error
+	stderr := captureStderr(t, func() {
+		_, err = queryPrometheusVector(context.Background(), "up")
+	})
+	if err == nil || !strings.Contains(err.Error(), "prometheus returned warnings for query up: partial data") {
+		t.Errorf("error = %v, want the warnings as an error", err)
+	}
+	if !strictWarningSeen.Load() {
+		t.Error("strictWarningSeen is not set, the run would not fail")
+	}
+	if stderr != "" {
+		t.Errorf("stderr = %q, want the warnings returned rather than printed", stderr)
+	}
+}
+
+func TestQueryPrometheusVectorErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "API error",
+			status:  http.StatusBadRequest,
+			body:    `{"status":"error","errorType":"bad_data","error":"parse error at char 4"}`,
+			wantErr: "received non-OK HTTP status: 400 Bad Request: bad_data: parse error at char 4",
+		},
+		{
+			name:    "API error with a 200 status",
+			status:  http.StatusOK,
+			body:    `{"status":"error","errorType":"execution","error":"query processing would load too many samples"}`,
+			wantErr: "prometheus query failed: execution: query processing would load too many samples",
+		},
+		{
+			name:    "non-JSON body",
+			status:  http.StatusOK,
+			body:    `<html>Sign in</html>`,
+			wantErr: "parsing Prometheus response",
+		},
+		{
+			name:    "unexpected result type",
+			status:  http.StatusOK,
+			body:    `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			wantErr: `unexpected result type "matrix" for instant query`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newPrometheusStub(t, respondWith(tt.status, tt.body))
+
+			_, err := queryPrometheusVector(context.Background(), "up")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchPrometheusRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int // Number of requests failing before one succeeds
+		failStatus   int
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{name: "transient errors then success", failures: 2, failStatus: http.StatusServiceUnavailable, wantAttempts: 3},
+		{name: "bad query is not retried", failures: 2, failStatus: http.StatusBadRequest, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) <= int32(tt.failures) {
+					respondWith(tt.failStatus, `{"status":"error","errorType":"unavailable","error":"compacting"}`)(w, r)
+					return
+				}
+				respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[]}}`)(w, r)
+			})
+			maxRetries = 3
+
+			_, err := queryPrometheusVector(context.Background(), "up")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %t", err, tt.wantErr)
+			}
+			// Retries stop at the first success, well before maxRetries
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPrometheusHTTPErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "unauthorized",
+			status:  http.StatusUnauthorized,
+			body:    `Unauthorized`,
+			wantErr: "received non-OK HTTP status: 401 Unauthorized (check the bearer token or basic auth credentials)",
+		},
+		{
+			name:    "forbidden",
+			status:  http.StatusForbidden,
+			body:    `{"status":"error","errorType":"forbidden","error":"tenant not allowed"}`,
+			wantErr: "received non-OK HTTP status: 403 Forbidden: forbidden: tenant not allowed (the credentials are not allowed to query this Prometheus or tenant)",
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			body:    `{"status":"error","errorType":"internal","error":"out of memory"}`,
+			wantErr: "received non-OK HTTP status: 500 Internal Server Error: internal: out of memory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newPrometheusStub(t, respondWith(tt.status, tt.body))
+
+			_, err := queryPrometheusVector(context.Background(), "up")
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+			var httpErr *prometheusHTTPError
+			if !errors.As(err, &httpErr) || httpErr.statusCode != tt.status {
+				t.Errorf("error = %#v, want a prometheusHTTPError with status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestPrometheusHTTPErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  prometheusHTTPError
+		want string
+	}{
+		{
+			name: "status only",
+			err:  prometheusHTTPError{statusCode: http.StatusBadGateway, status: "502 Bad Gateway"},
+			want: "received non-OK HTTP status: 502 Bad Gateway",
+		},
+		{
+			name: "error type and message",
+			err:  prometheusHTTPError{statusCode: http.StatusBadRequest, status: "400 Bad Request", errorType: "bad_data", message: "parse error"},
+			want: "received non-OK HTTP status: 400 Bad Request: bad_data: parse error",
+		},
+		{
+			name: "message without error type",
+			err:  prometheusHTTPError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable", message: "loading"},
+			want: "received non-OK HTTP status: 503 Service Unavailable: loading",
+		},
+		{
+			name: "error type without message",
+			err:  prometheusHTTPError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable", errorType: "unavailable"},
+			want: "received non-OK HTTP status: 503 Service Unavailable: unavailable",
+		},
+		{
+			name: "unauthorized hint",
+			err:  prometheusHTTPError{statusCode: http.StatusUnauthorized, status: "401 Unauthorized"},
+			want: "received non-OK HTTP status: 401 Unauthorized (check the bearer token or basic auth credentials)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPrometheusHTTPError(t *testing.T) {
+	tests := []struct {
+		name                       string
+		body                       string
+		wantErrorType, wantMessage string
+	}{
+		{name: "API error", body: `{"status":"error","errorType":"timeout","error":"query timed out"}`, wantErrorType: "timeout", wantMessage: "query timed out"},
+		{name: "proxy page", body: `<html>Bad Gateway</html>`},
+		{name: "empty body", body: ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway", Body: io.NopCloser(strings.NewReader(tt.body))}
+			got := newPrometheusHTTPError(resp)
+			if got.statusCode != http.StatusBadGateway || got.status != "502 Bad Gateway" || got.errorType != tt.wantErrorType || got.message != tt.wantMessage {
+				t.Errorf("newPrometheusHTTPError() = %+v, want error type %q and message %q", *got, tt.wantErrorType, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestQueryPrometheusRangeAPIError(t *testing.T) {
+	newPrometheusStub(t, respondWith(http.StatusOK, `{"status":"error","errorType":"timeout","error":"query timed out"}`))
+
+	end := time.Now()
+	_, err := queryPrometheusRange(context.Background(), "up", end.Add(-time.Hour), end, time.Minute)
+	if want := "prometheus query failed: timeout: query timed out"; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+}
+
+func TestQueryPrometheusCanceledContext(t *testing.T) {
+	var attempts atomic.Int32
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		respondWith(http.StatusServiceUnavailable, "")(w, r)
+	})
+	maxRetries = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	_, err := queryPrometheusVector(ctx, "up")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	// A retry would wait out a backoff of at least initialRetryBackoff
+	if elapsed := time.Since(start); elapsed >= initialRetryBackoff {
+		t.Errorf("query took %s, want it to return promptly", elapsed)
+	}
+	if got := attempts.Load(); got != 0 {
+		t.Errorf("got %d requests, want none", got)
+	}
+}
+
+// setConfig sets a config key for the duration of the test
+func setConfig(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	saved := viper.Get(key)
+	t.Cleanup(func() { viper.Set(key, saved) })
+	viper.Set(key, value)
+}
+
+func TestPrometheusTenantHeader(t *testing.T) {
+	var gotTenant, gotHeader string
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		gotTenant, gotHeader = r.Header.Get(tenantHeader), r.Header.Get("X-Team")
+		respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[]}}`)(w, r)
+	})
+	setConfig(t, "prometheus.tenant", "team-a")
+	setConfig(t, "prometheus.headers", map[string]string{"X-Team": "capacity"})
+	if err := configurePrometheusClient(); err != nil {
+		t.Fatalf("configuring the client: %v", err)
+	}
+
+	if _, err := queryPrometheusVector(context.Background(), "up"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotTenant != "team-a" {
+		t.Errorf("%s header = %q, want team-a", tenantHeader, gotTenant)
+	}
+	if gotHeader != "capacity" {
+		t.Errorf("X-Team header = %q, want capacity", gotHeader)
+	}
+}
+
+func TestValidatePrometheusURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr error // nil for a valid URL, or the error it wraps
+		wantMsg string
+	}{
+		{url: "http://localhost:9090"},
+		{url: "https://prometheus.example.com/prometheus"},
+		{url: "localhost:9090", wantErr: errPrometheusURLScheme, wantMsg: `invalid prometheus URL "localhost:9090": scheme must be http or https`},
+		{url: "prometheus.example.com", wantErr: errPrometheusURLScheme, wantMsg: `invalid prometheus URL "prometheus.example.com": scheme must be http or https`},
+		{url: "ftp://prometheus.example.com", wantErr: errPrometheusURLScheme, wantMsg: `invalid prometheus URL "ftp://prometheus.example.com": scheme must be http or https`},
+		{url: "http://", wantErr: errPrometheusURLHost, wantMsg: `invalid prometheus URL "http://": host is missing`},
+		{url: "http:///api", wantErr: errPrometheusURLHost, wantMsg: `invalid prometheus URL "http:///api": host is missing`},
+		{url: "http://localhost:9090?tenant=a", wantErr: errPrometheusURLQuery, wantMsg: `invalid prometheus URL "http://localhost:9090?tenant=a": query string and fragment are not allowed, API paths are appended to the URL`},
+		{url: "http://localhost:9090#graph", wantErr: errPrometheusURLQuery, wantMsg: `invalid prometheus URL "http://localhost:9090#graph": query string and fragment are not allowed, API paths are appended to the URL`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := validatePrometheusURL(tt.url)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) || err.Error() != tt.wantMsg {
+				t.Errorf("error = %v, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+
+	// A URL that doesn't parse reports the parse error
+	if err := validatePrometheusURL("http://[::1"); err == nil || !strings.HasPrefix(err.Error(), `invalid prometheus URL "http://[::1": parse`) {
+		t.Errorf("error = %v, want the parse error", err)
+	}
+}
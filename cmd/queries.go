@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// rateWindow is the range over which rate() computes per-second CPU usage
+var rateWindow time.Duration
+
+// aggregation is the outer aggregation of namespace CPU usage queries: sum, avg or max
+var aggregation = "sum"
+
+// aggregationOperators maps the values of --aggregation to PromQL aggregation operators
+var aggregationOperators = map[string]string{
+	"sum": "sum",
+	"avg": "avg",
+	"max": "max",
+}
+
+// extraMatchers are the label matchers from --label added to the selectors of every generated query
+var extraMatchers []string
+
+// labelNamePattern matches valid Prometheus label names
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// parseLabelMatchers converts key=value pairs into equality label matchers with the values quoted and escaped
+func parseLabelMatchers(labels []string) ([]string, error) {
+	matchers := make([]string, 0, len(labels))
+	for _, label := range labels {
+		name, value, found := strings.Cut(label, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid label %q: must be in the form key=value", label)
+		}
+		if !labelNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid label %q: %q is not a valid label name", label, name)
+		}
+		matchers = append(matchers, fmt.Sprintf("%s=%s", name, strconv.Quote(value)))
+	}
+	return matchers, nil
+}
+
+// addRateWindowFlag registers the --rate-window flag on a command
+func addRateWindowFlag(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&rateWindow, "rate-window", 5*time.Minute, "Window of the rate() in CPU usage queries, e.g. 2m or 30s")
+}
+
+// validateRateWindow checks the rate window, warning when it is too short to contain two samples
+func validateRateWindow() error {
+	if rateWindow <= 0 || rateWindow%time.Millisecond != 0 {
+		return fmt.Errorf("invalid rate window %s: must be a positive whole number of milliseconds", rateWindow)
+	}
+	// rate() needs at least two samples in the window, otherwise it silently returns nothing
+	if scrapeInterval := viper.GetDuration("prometheus.scrape_interval"); rateWindow < 2*scrapeInterval {
+		fmt.Fprintf(os.Stderr, "Warning: rate window %s is shorter than two scrape intervals (%s), CPU usage may be missing\n", formatPrometheusDuration(rateWindow), formatPrometheusDuration(scrapeInterval))
+	}
+	return nil
+}
+
+// addAggregationFlag registers the --aggregation flag on a command
+func addAggregationFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&aggregation, "aggregation", "sum", "Aggregation of the CPU usage of the containers of a namespace: sum, avg, or max for the busiest container")
+}
+
+// aggregationOperator returns the PromQL operator for an aggregation name
+func aggregationOperator(name string) (string, error) {
+	operator, ok := aggregationOperators[name]
+	if !ok {
+		return "", fmt.Errorf("invalid aggregation %q: must be one of sum, avg, max", name)
+	}
+	return operator, nil
+}
+
+// validateAggregation checks --aggregation. A configured cpu_usage_by_namespace query has its own aggregation, which
+// --aggregation can't change.
+func validateAggregation() error {
+	if _, err := aggregationOperator(aggregation); err != nil {
+		return err
+	}
+	if _, ok := queryTemplates["cpu_usage_by_namespace"]; ok && aggregation != "sum" {
+		return fmt.Errorf("--aggregation %s can't be used with the cpu_usage_by_namespace query of the config file, which sets its own aggregation", aggregation)
+	}
+	return nil
+}
+
+// formatPrometheusDuration formats a duration as a Prometheus duration string such as 2m, 30s or 1h30m
+func formatPrometheusDuration(d time.Duration) string {
+	if d%time.Second != 0 {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+
+	var b strings.Builder
+	for _, unit := range []struct {
+		size   time.Duration
+		suffix string
+	}{{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}} {
+		if n := d / unit.size; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.suffix)
+			d -= n * unit.size
+		}
+	}
+	if b.Len() == 0 {
+		return "0s"
+	}
+	return b.String()
+}
+
+// parsePrometheusDuration parses a Prometheus duration string such as 30m, 14d or 1h30m.
+// Days are 24 hours, weeks 7 days and years 365 days, as in Prometheus.
+func parsePrometheusDuration(value string) (time.Duration, error) {
+	if !prometheusDurationPattern.MatchString(value) {
+		return 0, fmt.Errorf("invalid duration %q: must be a Prometheus duration such as 30m, 1d or 14d", value)
+	}
+	units := map[string]time.Duration{
+		"ms": time.Millisecond, "s": time.Second, "m": time.Minute, "h": time.Hour,
+		"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour,
+	}
+	var total time.Duration
+	for _, part := range prometheusDurationPartPattern.FindAllStringSubmatch(value, -1) {
+		n, err := strconv.ParseInt(part[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		total += time.Duration(n) * units[part[2]]
+	}
+	return total, nil
+}
+
+// prometheusDurationPartPattern matches one number and unit of a Prometheus duration
+var prometheusDurationPartPattern = regexp.MustCompile(`([0-9]+)(ms|s|m|h|d|w|y)`)
+
+// labelSelector joins label matchers and the matchers from --label into the body of a PromQL selector,
+// skipping empty ones
+func labelSelector(matchers ...string) string {
+	var nonEmpty []string
+	for _, matcher := range append(matchers, extraMatchers...) {
+		if matcher != "" {
+			nonEmpty = append(nonEmpty, matcher)
+		}
+	}
+	return strings.Join(nonEmpty, ", ")
+}
+
+// namespaceCPUUsageQuery returns the PromQL for the current CPU usage of a namespace in cores
+func namespaceCPUUsageQuery(namespace string) string {
+	if query, ok := renderQueryTemplate("cpu_usage_by_namespace", namespace, ""); ok {
+		return query
+	}
+	// Validated before any query is built
+	operator, _ := aggregationOperator(aggregation)
+	// The recording rule is already a rate aggregated by namespace
+	if cpuRecordingRule != "" {
+		return fmt.Sprintf(`%s(%s{%s})`, operator, cpuRecordingRule, labelSelector(namespaceMatcher(namespace)))
+	}
+	return fmt.Sprintf(
+		`%s(rate(container_cpu_usage_seconds_total{%s}[%s]))`,
+		operator, labelSelector(namespaceMatcher(namespace), `container!=""`), formatPrometheusDuration(rateWindow),
+	)
+}
+
+// namespaceMemoryUsageQuery returns the PromQL for the current memory working set of a namespace in bytes
+func namespaceMemoryUsageQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum(container_memory_working_set_bytes{%s})`,
+		labelSelector(namespaceMatcher(namespace), `container!=""`),
+	)
+}
+
+// topNamespacesCPUUsageQuery returns the PromQL for the n namespaces using the most CPU, in cores
+func topNamespacesCPUUsageQuery(n int) string {
+	if cpuRecordingRule != "" {
+		return fmt.Sprintf(`topk(%d, sum by (namespace) (%s{%s}))`, n, cpuRecordingRule, labelSelector())
+	}
+	return fmt.Sprintf(
+		`topk(%d, sum by (namespace) (rate(container_cpu_usage_seconds_total{%s}[%s])))`,
+		n, labelSelector(`container!=""`), formatPrometheusDuration(rateWindow),
+	)
+}
+
+// topNamespacesMemoryUsageQuery returns the PromQL for the n namespaces using the most memory, in bytes of working set
+func topNamespacesMemoryUsageQuery(n int) string {
+	return fmt.Sprintf(
+		`topk(%d, sum by (namespace) (container_memory_working_set_bytes{%s}))`,
+		n, labelSelector(`container!=""`),
+	)
+}
+
+// newestCPUUsageSampleQuery returns the PromQL for the Unix time of the newest CPU usage sample of a namespace within
+// window. A plain instant query would only see samples within the lookback delta of Prometheus, and none at all for
+// series ended by a staleness marker, so the sample times are taken over a subquery.
+func newestCPUUsageSampleQuery(namespace string, window time.Duration) string {
+	series := fmt.Sprintf(`container_cpu_usage_seconds_total{%s}`, labelSelector(namespaceMatcher(namespace), `container!=""`))
+	if cpuRecordingRule != "" {
+		series = fmt.Sprintf(`%s{%s}`, cpuRecordingRule, labelSelector(namespaceMatcher(namespace)))
+	}
+	return fmt.Sprintf(`max(max_over_time(timestamp(%s)[%s:]))`, series, formatPrometheusDuration(window))
+}
+
+// namespaceCPURequestsQuery returns the PromQL for the CPU requested by the containers of a namespace in cores
+func namespaceCPURequestsQuery(namespace string) string {
+	if query, ok := renderQueryTemplate("cpu_requests_by_namespace", namespace, ""); ok {
+		return query
+	}
+	return fmt.Sprintf(
+		`sum(kube_pod_container_resource_requests{%s})`,
+		labelSelector(namespaceMatcher(namespace), `resource="cpu"`),
+	)
+}
+
+// namespaceNetworkReceiveQuery returns the PromQL for the bytes per second received by the pods of a namespace
+func namespaceNetworkReceiveQuery(namespace string) string {
+	if query, ok := renderQueryTemplate("network_receive_by_namespace", namespace, ""); ok {
+		return query
+	}
+	return fmt.Sprintf(
+		`sum(rate(container_network_receive_bytes_total{%s}[%s]))`,
+		labelSelector(namespaceMatcher(namespace)), formatPrometheusDuration(rateWindow),
+	)
+}
+
+// namespaceNetworkTransmitQuery returns the PromQL for the bytes per second transmitted by the pods of a namespace
+func namespaceNetworkTransmitQuery(namespace string) string {
+	if query, ok := renderQueryTemplate("network_transmit_by_namespace", namespace, ""); ok {
+		return query
+	}
+	return fmt.Sprintf(
+		`sum(rate(container_network_transmit_bytes_total{%s}[%s]))`,
+		labelSelector(namespaceMatcher(namespace)), formatPrometheusDuration(rateWindow),
+	)
+}
+
+// pvcUsedBytesQuery returns the PromQL for the bytes used by every mounted PersistentVolumeClaim of a namespace
+func pvcUsedBytesQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum by (namespace, persistentvolumeclaim) (kubelet_volume_stats_used_bytes{%s})`,
+		labelSelector(namespaceMatcher(namespace)),
+	)
+}
+
+// pvcCapacityBytesQuery returns the PromQL for the capacity in bytes of every mounted PersistentVolumeClaim of a namespace
+func pvcCapacityBytesQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum by (namespace, persistentvolumeclaim) (kubelet_volume_stats_capacity_bytes{%s})`,
+		labelSelector(namespaceMatcher(namespace)),
+	)
+}
+
+// podCPUPeriodsQuery returns the PromQL for the CFS periods per second elapsed by every pod of a namespace with CPU
+// limits
+func podCPUPeriodsQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum by (namespace, pod) (rate(container_cpu_cfs_periods_total{%s}[%s]))`,
+		labelSelector(namespaceMatcher(namespace), `container!=""`), formatPrometheusDuration(rateWindow),
+	)
+}
+
+// podCPUThrottledPeriodsQuery returns the PromQL for the CFS periods per second in which every pod of a namespace was
+// throttled
+func podCPUThrottledPeriodsQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum by (namespace, pod) (rate(container_cpu_cfs_throttled_periods_total{%s}[%s]))`,
+		labelSelector(namespaceMatcher(namespace), `container!=""`), formatPrometheusDuration(rateWindow),
+	)
+}
+
+// containerWorkingSetQuery returns the PromQL for the memory working set of every running container of a namespace
+func containerWorkingSetQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum by (namespace, pod, container) (container_memory_working_set_bytes{%s})`,
+		labelSelector(namespaceMatcher(namespace), `container!=""`, `container!="POD"`),
+	)
+}
+
+// containerMemoryLimitsQuery returns the PromQL for the memory limit of every container of a namespace that has one
+func containerMemoryLimitsQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum by (namespace, pod, container) (kube_pod_container_resource_limits{%s})`,
+		labelSelector(namespaceMatcher(namespace), `resource="memory"`),
+	)
+}
+
+// namespacesCreatedQuery returns the PromQL listing which of the given namespaces exist, as reported by
+// kube-state-metrics
+func namespacesCreatedQuery(namespaces []string) string {
+	quoted := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		quoted = append(quoted, regexp.QuoteMeta(namespace))
+	}
+	return fmt.Sprintf(
+		`count by (namespace) (kube_namespace_created{%s})`,
+		labelSelector(fmt.Sprintf(`namespace=~%s`, strconv.Quote(strings.Join(quoted, "|")))),
+	)
+}
+
+// namespaceQuotaQuery returns the PromQL for the used and hard values of every ResourceQuota in a namespace
+func namespaceQuotaQuery(namespace string) string {
+	if query, ok := renderQueryTemplate("quotas_by_namespace", namespace, ""); ok {
+		return query
+	}
+	return fmt.Sprintf(`kube_resourcequota{%s}`, labelSelector(namespaceMatcher(namespace)))
+}
+
+// nodeCPUAllocatableQuery returns the PromQL for the allocatable CPU of every node in cores
+func nodeCPUAllocatableQuery() string {
+	return fmt.Sprintf(`sum by (node) (kube_node_status_allocatable{%s})`, labelSelector(`resource="cpu"`)) + nodeSelectorFilter()
+}
+
+// nodeCPURequestsQuery returns the PromQL for the CPU requested by the containers scheduled on every node in cores
+func nodeCPURequestsQuery() string {
+	return fmt.Sprintf(`sum by (node) (kube_pod_container_resource_requests{%s})`, labelSelector(`resource="cpu"`)) + nodeSelectorFilter()
+}
+
+// nodeUnschedulableQuery returns the PromQL for the nodes that are cordoned
+func nodeUnschedulableQuery() string {
+	return fmt.Sprintf(`kube_node_spec_unschedulable{%s} == 1`, labelSelector()) + nodeSelectorFilter()
+}
+
+// nodeSelectorFilter returns the PromQL keeping only the nodes matching --node-selector, to append to a query with a
+// node label, or "" when no selector is set
+func nodeSelectorFilter() string {
+	if len(nodeLabelMatchers) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(` and on (node) kube_node_labels{%s}`, labelSelector(nodeLabelMatchers...))
+}
+
+// clusterAllocatableQuery returns the PromQL for the amount of a resource, cpu or memory, allocatable across all nodes
+func clusterAllocatableQuery(resource string) string {
+	return fmt.Sprintf(`sum(kube_node_status_allocatable{%s})`, labelSelector("resource="+strconv.Quote(resource)))
+}
+
+// clusterRequestsQuery returns the PromQL for the amount of a resource, cpu or memory, requested by all containers
+func clusterRequestsQuery(resource string) string {
+	return fmt.Sprintf(`sum(kube_pod_container_resource_requests{%s})`, labelSelector("resource="+strconv.Quote(resource)))
+}
+
+// podOwnerCPUUsageQuery returns the PromQL for the current CPU usage of every pod of a namespace in cores,
+// labelled with the kind and name of the pod's owner
+func podOwnerCPUUsageQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum by (namespace, pod, owner_kind, owner_name) (
+  sum by (namespace, pod) (rate(container_cpu_usage_seconds_total{%s}[%s]))
+  * on (namespace, pod) group_left (owner_kind, owner_name) max by (namespace, pod, owner_kind, owner_name) (kube_pod_owner{%s})
+)`,
+		labelSelector(namespaceMatcher(namespace), `container!=""`), formatPrometheusDuration(rateWindow),
+		labelSelector(namespaceMatcher(namespace)),
+	)
+}
+
+// podGPUUtilizationSelector returns the PromQL for the utilization of every GPU assigned to a pod of a namespace.
+// Depending on its configuration, DCGM exporter reports the pod of a GPU in the exported_namespace and exported_pod
+// labels, which are moved to namespace and pod before joining with kube_pod_info.
+func podGPUUtilizationSelector(namespace string) string {
+	return fmt.Sprintf(
+		`label_replace(label_replace(DCGM_FI_DEV_GPU_UTIL{%s}, "namespace", "$1", "exported_namespace", "(.+)"), "pod", "$1", "exported_pod", "(.+)")
+  * on (namespace, pod) group_left () max by (namespace, pod) (kube_pod_info{%s})`,
+		labelSelector(), labelSelector(namespaceMatcher(namespace)),
+	)
+}
+
+// namespaceGPUUtilizationQuery returns the PromQL for the average utilization in percent of the GPUs used by a namespace
+func namespaceGPUUtilizationQuery(namespace string) string {
+	return fmt.Sprintf("avg(%s)", podGPUUtilizationSelector(namespace))
+}
+
+// namespaceGPUDevicesQuery returns the PromQL for the number of GPUs used by the pods of a namespace
+func namespaceGPUDevicesQuery(namespace string) string {
+	return fmt.Sprintf("count(%s)", podGPUUtilizationSelector(namespace))
+}
+
+// namespaceGPURequestsQuery returns the PromQL for the GPUs requested by the containers of a namespace
+func namespaceGPURequestsQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum(kube_pod_container_resource_requests{%s})`,
+		labelSelector(namespaceMatcher(namespace), `resource="nvidia_com_gpu"`),
+	)
+}
+
+// containerCPUUsageQuery returns the PromQL for the CPU usage of the containers matching selector in cores
+func containerCPUUsageQuery(selector string) string {
+	return fmt.Sprintf(`node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{%s}`, selector)
+}
+
+// containerMemoryUsageQuery returns the PromQL for the memory usage of the containers matching selector in bytes.
+// The working set is used as that is what the OOM killer acts on.
+func containerMemoryUsageQuery(selector string) string {
+	return fmt.Sprintf(`container_memory_working_set_bytes{%s}`, selector)
+}
+
+// containerCPUPercentileQuery returns the PromQL for a percentile of the CPU usage of the containers matching
+// selector over window, in cores
+func containerCPUPercentileQuery(selector string, percentile float64, window string) string {
+	return fmt.Sprintf(`quantile_over_time(%g, %s[%s])`, percentile, containerCPUUsageQuery(selector), window)
+}
+
+// containerMemoryPercentileQuery returns the PromQL for a percentile of the memory usage of the containers matching
+// selector over window, in bytes
+func containerMemoryPercentileQuery(selector string, percentile float64, window string) string {
+	return fmt.Sprintf(`quantile_over_time(%g, %s[%s])`, percentile, containerMemoryUsageQuery(selector), window)
+}
+
+// podContainerCPUUsageQuery returns the PromQL for the CPU usage of every container of a pod in cores
+func podContainerCPUUsageQuery(namespace, pod string) string {
+	if query, ok := renderQueryTemplate("cpu_usage_by_container", namespace, pod); ok {
+		return query
+	}
+	return fmt.Sprintf(
+		`sum by (container) (rate(container_cpu_usage_seconds_total{%s}[%s]))`,
+		labelSelector(namespaceMatcher(namespace), "pod="+strconv.Quote(pod), `container!=""`), formatPrometheusDuration(rateWindow),
+	)
+}
+
+// imageCPUUsageQuery returns the PromQL for the current CPU usage of the containers of a namespace by image.
+// kube-state-metrics provides the image of every container.
+func imageCPUUsageQuery(namespace string) string {
+	return fmt.Sprintf(
+		`sum by (image) (
+  sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{%s}[%s]))
+  * on (namespace, pod, container) group_left (image) max by (namespace, pod, container, image) (kube_pod_container_info{%s})
+)`,
+		labelSelector(namespaceMatcher(namespace), `container!=""`), formatPrometheusDuration(rateWindow),
+		labelSelector(namespaceMatcher(namespace)),
+	)
+}
+
+// replicaSetOwnerQuery returns the PromQL for the owners of the ReplicaSets of a namespace
+func replicaSetOwnerQuery(namespace string) string {
+	return fmt.Sprintf(`kube_replicaset_owner{%s}`, labelSelector(namespaceMatcher(namespace)))
+}
+
+// runningContainersQuery returns the PromQL for the containers of the running pods of a namespace
+func runningContainersQuery(namespace string) string {
+	return fmt.Sprintf(
+		`kube_pod_container_info{%s} * on (namespace, pod) group_left () (kube_pod_status_phase{%s} == 1)`,
+		labelSelector(namespaceMatcher(namespace)), labelSelector(namespaceMatcher(namespace), `phase="Running"`),
+	)
+}
+
+// containerCPURequestsQuery returns the PromQL for the CPU requests of every container of a namespace
+func containerCPURequestsQuery(namespace string) string {
+	return fmt.Sprintf(
+		`kube_pod_container_resource_requests{%s}`,
+		labelSelector(namespaceMatcher(namespace), `resource="cpu"`),
+	)
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestAggregationOperator(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "sum", want: "sum"},
+		{name: "avg", want: "avg"},
+		{name: "max", want: "max"},
+		{name: "min", wantErr: true},
+		{name: "SUM", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := aggregationOperator(tt.name)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "must be one of sum, avg, max") {
+					t.Errorf("aggregationOperator(%q) error = %v, want an invalid aggregation error", tt.name, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("aggregationOperator(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// useAggregation sets --aggregation and the query settings it is combined with for the duration of the test
+func useAggregation(t *testing.T, name string) {
+	t.Helper()
+	savedAggregation, savedWindow, savedRule, savedTemplates, savedMatchers := aggregation, rateWindow, cpuRecordingRule, queryTemplates, extraMatchers
+	t.Cleanup(func() {
+		aggregation, rateWindow, cpuRecordingRule, queryTemplates, extraMatchers = savedAggregation, savedWindow, savedRule, savedTemplates, savedMatchers
+	})
+	aggregation, rateWindow, cpuRecordingRule, queryTemplates, extraMatchers = name, 5*time.Minute, "", map[string]*template.Template{}, nil
+}
+
+func TestNamespaceCPUUsageQueryAggregation(t *testing.T) {
+	useAggregation(t, "max")
+	want := `max(rate(container_cpu_usage_seconds_total{namespace="a", container!=""}[5m]))`
+	if got := namespaceCPUUsageQuery("a"); got != want {
+		t.Errorf("namespaceCPUUsageQuery() = %s, want %s", got, want)
+	}
+
+	cpuRecordingRule = "namespace:container_cpu_usage:sum"
+	want = `max(namespace:container_cpu_usage:sum{namespace="a"})`
+	if got := namespaceCPUUsageQuery("a"); got != want {
+		t.Errorf("namespaceCPUUsageQuery() with a recording rule = %s, want %s", got, want)
+	}
+}
+
+func TestValidateAggregationWithQueryTemplate(t *testing.T) {
+	useAggregation(t, "avg")
+	queryTemplates["cpu_usage_by_namespace"] = template.Must(template.New("cpu_usage_by_namespace").Parse(`sum(up)`))
+	if err := validateAggregation(); err == nil {
+		t.Error("validateAggregation() accepted --aggregation avg with a configured cpu_usage_by_namespace query")
+	}
+
+	aggregation = "sum"
+	if err := validateAggregation(); err != nil {
+		t.Errorf("validateAggregation() = %v, want the default aggregation accepted", err)
+	}
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	useAggregation(t, "sum")
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "all namespaces", got: namespaceMatcher(""), want: ``},
+		{name: "namespace", got: namespaceMatcher(`a"b\c`), want: `namespace="a\"b\\c"`},
+		{name: "container selector", got: containerSelector(`a"b`, `app\x`, `web"1`), want: `namespace="a\"b", container="app\\x", pod="web\"1"`},
+		{
+			name: "pod query",
+			got:  podContainerCPUUsageQuery("a", `web"1`),
+			want: `sum by (container) (rate(container_cpu_usage_seconds_total{namespace="a", pod="web\"1", container!=""}[5m]))`,
+		},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseLabelMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  []string
+		want    []string
+		wantErr string
+	}{
+		{name: "none", labels: nil, want: []string{}},
+		{name: "pairs", labels: []string{"cluster=prod", "team=a"}, want: []string{`cluster="prod"`, `team="a"`}},
+		{name: "empty value", labels: []string{"cluster="}, want: []string{`cluster=""`}},
+		{name: "value containing =", labels: []string{"selector=a=b"}, want: []string{`selector="a=b"`}},
+		{name: "quotes and backslashes are escaped", labels: []string{`path=C:\a"b`}, want: []string{`path="C:\\a\"b"`}},
+		{name: "missing =", labels: []string{"cluster"}, wantErr: `invalid label "cluster": must be in the form key=value`},
+		{name: "invalid label name", labels: []string{"team-name=a"}, wantErr: `"team-name" is not a valid label name`},
+		{name: "name starting with a digit", labels: []string{"1team=a"}, wantErr: `"1team" is not a valid label name`},
+		{name: "empty name", labels: []string{"=a"}, wantErr: `"" is not a valid label name`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLabelMatchers(tt.labels)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") || len(got) != len(tt.want) {
+				t.Errorf("parseLabelMatchers(%q) = %q, want %q", tt.labels, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelMatchersInQueries(t *testing.T) {
+	useAggregation(t, "sum")
+	matchers, err := parseLabelMatchers([]string{"cluster=prod", `team=a"b`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	extraMatchers = matchers
+
+	want := `sum(rate(container_cpu_usage_seconds_total{namespace="a", container!="", cluster="prod", team="a\"b"}[5m]))`
+	if got := namespaceCPUUsageQuery("a"); got != want {
+		t.Errorf("namespaceCPUUsageQuery() = %s, want %s", got, want)
+	}
+	// Queries over all namespaces are narrowed too
+	if got := namespaceCPUUsageQuery(""); !strings.Contains(got, `{container!="", cluster="prod", team="a\"b"}`) {
+		t.Errorf("namespaceCPUUsageQuery() = %s, want the --label matchers", got)
+	}
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// queryAt is the raw value of the --at flag
+var queryAt string
+
+// querySample is one value of an ad-hoc query result. Values are kept as returned by Prometheus so that
+// string results and special values such as NaN or +Inf are printed unchanged.
+type querySample struct {
+	Metric    map[string]string `json:"metric,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Value     string            `json:"value"`
+	// resultType is set to scalar or string for results that are not series, which have no labels to show
+	resultType string
+}
+
+// formatSeries returns how the series of a sample is shown in text and table output: its labels, or the result
+// type for scalar and string results
+func (s querySample) formatSeries() string {
+	if s.resultType != "" {
+		return s.resultType
+	}
+	return formatMetric(s.Metric)
+}
+
+// formatValue returns how the value of a sample is shown in text and table output. String results are quoted so
+// that empty or blank strings remain visible.
+func (s querySample) formatValue() string {
+	if s.resultType == "string" {
+		return strconv.Quote(s.Value)
+	}
+	return s.Value
+}
+
+// queryCmd represents the query command
+var queryCmd = &cobra.Command{
+	Use:   "query <promql|->",
+	Short: "Run a PromQL expression against the configured Prometheus",
+	Long: `Query runs an arbitrary PromQL expression as an instant query, using the configured URL,
+credentials and TLS settings, and prints every returned sample. Range vector selectors return
+all samples in the range. With --at the expression is evaluated at a past time, given as an
+RFC3339 timestamp or relative to now, e.g. -2h or -30m.
+
+Pass - instead of an expression to read it from stdin, e.g. to run a long multi-line query
+kept in a file.`,
+	Example: `  k query 'sum by (namespace) (kube_pod_container_resource_requests{resource="cpu"})'
+  k query --at -2h 'sum(kube_pod_container_resource_requests{resource="cpu"})'
+  k query - < requests.promql`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+			return fmt.Errorf("expected a single non-empty PromQL expression, e.g. k query 'up'")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var at time.Time
+		if queryAt != "" {
+			var err error
+			if at, err = parseEvaluationTime(queryAt, evaluationNow()); err != nil {
+				return err
+			}
+		}
+
+		query := args[0]
+		if query == "-" {
+			var err error
+			if query, err = readQueryFromStdin(); err != nil {
+				return err
+			}
+		}
+
+		samples, err := runQuery(cmd.Context(), query, at)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case outputFormat == "json":
+			return printJSON(samples)
+		case len(samples) == 0:
+			fmt.Println("No data returned")
+		case outputFormat == "table":
+			rows := make([][]string, 0, len(samples))
+			for _, sample := range samples {
+				rows = append(rows, []string{sample.formatSeries(), sample.formatValue(), sample.Timestamp.Format(time.RFC3339)})
+			}
+			fmt.Print(renderTable([]string{"METRIC", "VALUE", "TIMESTAMP"}, rows))
+		default:
+			for _, sample := range samples {
+				fmt.Printf("%s %s @ %s\n", sample.formatSeries(), sample.formatValue(), sample.Timestamp.Format(time.RFC3339))
+			}
+		}
+		return nil
+	},
+}
+
+// readQueryFromStdin reads a PromQL expression piped to stdin, refusing to wait for input typed at a terminal
+func readQueryFromStdin() (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("expected a PromQL expression piped to stdin, e.g. k query - < query.promql")
+	}
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("reading query from stdin: %w", err)
+	}
+	query := strings.TrimRightFunc(string(input), unicode.IsSpace)
+	if strings.TrimSpace(query) == "" {
+		return "", fmt.Errorf("expected a non-empty PromQL expression on stdin")
+	}
+	return query, nil
+}
+
+// parseEvaluationTime parses an RFC3339 timestamp or a negative duration relative to now such as -2h or -7d
+func parseEvaluationTime(value string, now time.Time) (time.Time, error) {
+	if strings.HasPrefix(value, "-") {
+		offset, err := time.ParseDuration(value)
+		if err != nil {
+			// Also accept the day, week and year units of Prometheus durations
+			if offset, promErr := parsePrometheusDuration(value[1:]); promErr == nil {
+				return now.Add(-offset), nil
+			}
+			return time.Time{}, fmt.Errorf("invalid evaluation time %q: %w", value, err)
+		}
+		return now.Add(offset), nil
+	}
+	ts, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid evaluation time %q: must be an RFC3339 timestamp or relative to now, e.g. -2h", value)
+	}
+	return ts, nil
+}
+
+// runQuery runs an instant query at ts, or now if it is zero, and flattens the result, whatever its type, into samples
+func runQuery(ctx context.Context, query string, ts time.Time) ([]querySample, error) {
+	resultType, result, err := queryPrometheusInstantAt(ctx, query, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []querySample{}
+	switch resultType {
+	case "vector":
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		}
+		if err := json.Unmarshal(result, &series); err != nil {
+			return nil, fmt.Errorf("parsing Prometheus response: %w", err)
+		}
+		for _, s := range series {
+			sample, err := parseQuerySample(s.Metric, s.Value)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, sample)
+		}
+	case "matrix":
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][]interface{}   `json:"values"`
+		}
+		if err := json.Unmarshal(result, &series); err != nil {
+			return nil, fmt.Errorf("parsing Prometheus response: %w", err)
+		}
+		for _, s := range series {
+			for _, value := range s.Values {
+				sample, err := parseQuerySample(s.Metric, value)
+				if err != nil {
+					return nil, err
+				}
+				samples = append(samples, sample)
+			}
+		}
+	case "scalar", "string":
+		var value []interface{}
+		if err := json.Unmarshal(result, &value); err != nil {
+			return nil, fmt.Errorf("parsing Prometheus response: %w", err)
+		}
+		sample, err := parseQuerySample(nil, value)
+		if err != nil {
+			return nil, err
+		}
+		sample.resultType = resultType
+		samples = append(samples, sample)
+	default:
+		return nil, fmt.Errorf("unexpected result type %q for instant query", resultType)
+	}
+	return samples, nil
+}
+
+// parseQuerySample converts a [timestamp, value] pair of the Prometheus API into a sample
+func parseQuerySample(metric map[string]string, pair []interface{}) (querySample, error) {
+	if len(pair) != 2 {
+		return querySample{}, fmt.Errorf("malformed sample %v", pair)
+	}
+	timestamp, ok := pair[0].(float64)
+	if !ok {
+		return querySample{}, fmt.Errorf("unexpected timestamp type: %T", pair[0])
+	}
+	value, ok := pair[1].(string)
+	if !ok {
+		return querySample{}, fmt.Errorf("unexpected value type: %T", pair[1])
+	}
+	return querySample{Metric: metric, Timestamp: time.Unix(0, int64(timestamp*float64(time.Second))), Value: value}, nil
+}
+
+// formatMetric formats the labels of a series the way Prometheus does, e.g. up{job="node"}
+func formatMetric(metric map[string]string) string {
+	name := metric["__name__"]
+	var labels []string
+	for label, value := range metric {
+		if label != "__name__" {
+			labels = append(labels, fmt.Sprintf("%s=%q", label, value))
+		}
+	}
+	sort.Strings(labels)
+	if name != "" && len(labels) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(labels, ", ") + "}"
+}
+
+func init() {
+	rootCmd.AddCommand(queryCmd)
+	queryCmd.Flags().StringVar(&queryAt, "at", "", "Evaluate the expression at this time, an RFC3339 timestamp or relative to now such as -2h (default is now)")
+}
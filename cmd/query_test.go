@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunQueryResultTypes(t *testing.T) {
+	tests := []struct {
+		resultType string
+		result     string
+		want       []string // Samples as formatted in text output
+	}{
+		{
+			resultType: "vector",
+			result:     `[{"metric":{"__name__":"up","job":"node"},"value":[1700000000,"1"]},{"metric":{},"value":[1700000000,"NaN"]}]`,
+			want:       []string{`up{job="node"} 1 @ 1700000000`, `{} NaN @ 1700000000`},
+		},
+		{
+			resultType: "matrix",
+			result:     `[{"metric":{"job":"node"},"values":[[1700000000,"1"],[1700000060,"+Inf"]]}]`,
+			want:       []string{`{job="node"} 1 @ 1700000000`, `{job="node"} +Inf @ 1700000060`},
+		},
+		{
+			resultType: "scalar",
+			result:     `[1700000000,"42"]`,
+			want:       []string{`scalar 42 @ 1700000000`},
+		},
+		{
+			resultType: "string",
+			result:     `[1700000000,"hello world"]`,
+			want:       []string{`string "hello world" @ 1700000000`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resultType, func(t *testing.T) {
+			newPrometheusStub(t, respondWith(http.StatusOK,
+				fmt.Sprintf(`{"status":"success","data":{"resultType":%q,"result":%s}}`, tt.resultType, tt.result)))
+
+			samples, err := runQuery(context.Background(), "expr", time.Time{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, sample := range samples {
+				got = append(got, fmt.Sprintf("%s %s @ %d", sample.formatSeries(), sample.formatValue(), sample.Timestamp.Unix()))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("samples = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		newPrometheusStub(t, respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"histogram","result":[]}}`))
+		if _, err := runQuery(context.Background(), "expr", time.Time{}); err == nil || !strings.Contains(err.Error(), `unexpected result type "histogram"`) {
+			t.Errorf("error = %v, want an unexpected result type error", err)
+		}
+	})
+}
@@ -1,289 +1,849 @@
 package cmd
 
 import (
+	"cmp"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"math"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
 )
 
 // Declare global variables
 var (
 	debug                bool
-	timeWindow           string
-	prometheusURL        = getPrometheusURL() // Retrieve Prometheus URL dynamically
-	cpuPercentile        float64              // Configurable CPU percentile
-	memoryPercentile     float64              // Configurable Memory percentile
-	recommendQuotas      bool                 // Flag to indicate if resource quota recommendations are requested
-	recommendLimitRanges bool                 // Flag to indicate if limit range recommendations are requested
+	timeWindow           string  // Lookback window for the quantile_over_time queries
+	requestPercentile    float64 // Usage percentile recommended as the request
+	limitPercentile      float64 // Usage percentile recommended as the limit
+	cpuPercentile        float64 // Usage percentile recommended as the CPU limit, overriding limitPercentile
+	memoryPercentile     float64 // Usage percentile recommended as the memory limit, overriding limitPercentile
+	recommendQuotas      bool    // Flag to indicate if resource quota recommendations are requested
+	recommendLimitRanges bool    // Flag to indicate if limit range recommendations are requested
+	resource             string  // Resource to recommend for: cpu, memory or both
+	headroom             float64 // Safety buffer added to the usage percentiles, as a fraction
+	cpuRound             string  // Increment CPU recommendations are rounded up to, e.g. 50m
+	memoryRound          string  // Increment memory recommendations are rounded up to, e.g. 64Mi
+	pod                  string  // Optional pod to restrict recommendations to
 )
 
-// getPrometheusURL returns the Prometheus URL from environment variable or defaults to localhost:9090
-func getPrometheusURL() string {
-	if url, exists := os.LookupEnv("PROMETHEUS_URL"); exists {
-		return url
+// recommendOptions holds the settings of a recommend run. recommendCmd builds them from its flags, so that
+// recommendations can be computed without going through cobra.
+type recommendOptions struct {
+	resource          string        // Resource to recommend for: cpu, memory or both
+	pod               string        // Pod to restrict recommendations to, empty for every Deployment and StatefulSet
+	timeWindow        string        // Lookback window for the quantile_over_time queries
+	historyWindow     time.Duration // Window the percentiles are computed client-side over, 0 to use timeWindow
+	historyStep       time.Duration // Resolution of the samples fetched for historyWindow
+	requestPercentile float64       // Usage percentile recommended as the request
+	cpuPercentile     float64       // Usage percentile recommended as the CPU limit
+	memoryPercentile  float64       // Usage percentile recommended as the memory limit
+	headroom          float64       // Safety buffer added to the usage percentiles, as a fraction
+	cpuRound          k8sresource.Quantity
+	memoryRound       k8sresource.Quantity
+	failOverRatio     float64 // Ratio of usage to requests below which a container is over-provisioned, 0 to disable
+	quotas            bool    // Whether to recommend resource quotas
+	limitRanges       bool    // Whether to recommend limit ranges
+}
+
+// recommendOptionsFromFlags returns the options set by the flags of recommendCmd, once PreRunE has validated them
+func recommendOptionsFromFlags() recommendOptions {
+	return recommendOptions{
+		resource:          resource,
+		pod:               pod,
+		timeWindow:        timeWindow,
+		historyWindow:     historyWindow,
+		historyStep:       historyStep,
+		requestPercentile: requestPercentile,
+		cpuPercentile:     cpuPercentile,
+		memoryPercentile:  memoryPercentile,
+		headroom:          headroom,
+		cpuRound:          cpuRoundIncrement,
+		memoryRound:       memoryRoundIncrement,
+		failOverRatio:     failOverRatio,
+		quotas:            recommendQuotas,
+		limitRanges:       recommendLimitRanges,
 	}
-	return "http://localhost:9090" // Default URL
 }
 
 // recommendCmd represents the recommend command
 var recommendCmd = &cobra.Command{
 	Use:   "recommend",
 	Short: "Recommend resource limits and requests for each container and initContainer in Deployments and StatefulSets in a namespace",
-	Run: func(cmd *cobra.Command, args []string) {
-		namespace, _ := cmd.Flags().GetString("namespace")
-
-		// Use the "default" namespace if none is provided
-		if namespace == "" {
-			fmt.Println("No namespace provided. Using the 'default' namespace.")
-			namespace = "default"
+	// With --output yaml the recommendations are printed as resources stanzas ready to paste into manifests
+	Annotations: map[string]string{yamlOutputAnnotation: ""},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		namespaces, _ := cmd.Flags().GetStringSlice("namespace")
+		allNamespaces, _ := cmd.Flags().GetBool("all-namespaces")
+		if pod != "" && (len(uniqueStrings(namespaces)) > 1 || allNamespaces || cmd.Flags().Changed("namespace-file")) {
+			return fmt.Errorf("--pod requires a single namespace")
 		}
-
-		// Load kubeconfig
-		kubeconfig := clientcmd.NewDefaultClientConfigLoadingRules().GetDefaultFilename()
-		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			panic(err.Error())
+		if err := validateResource(resource); err != nil {
+			return err
 		}
-
-		// Create Kubernetes client
-		clientset, err := kubernetes.NewForConfig(config)
+		if err := validateFailOverRatio(); err != nil {
+			return err
+		}
+		if err := validateConcurrency(); err != nil {
+			return err
+		}
+		if err := validatePercentile("request-percentile", requestPercentile); err != nil {
+			return err
+		}
+		if err := validatePercentile("limit-percentile", limitPercentile); err != nil {
+			return err
+		}
+		// Per-resource limit percentiles of 0 fall back to the limit percentile
+		if cpuPercentile == 0 {
+			cpuPercentile = limitPercentile
+		} else if err := validatePercentile("cpu-percentile", cpuPercentile); err != nil {
+			return err
+		}
+		if memoryPercentile == 0 {
+			memoryPercentile = limitPercentile
+		} else if err := validatePercentile("memory-percentile", memoryPercentile); err != nil {
+			return err
+		}
+		if headroom < 0 {
+			return fmt.Errorf("invalid headroom %g: must not be negative", headroom)
+		}
+		var err error
+		if cpuRoundIncrement, err = parseRoundIncrement("cpu-round", cpuRound); err != nil {
+			return err
+		}
+		if memoryRoundIncrement, err = parseRoundIncrement("mem-round", memoryRound); err != nil {
+			return err
+		}
+		if history != "" {
+			if historyWindow, err = parsePrometheusDuration(history); err != nil {
+				return err
+			}
+			if historyStep <= 0 {
+				return fmt.Errorf("invalid history step %s: must be positive", historyStep)
+			}
+			// Check once up front rather than failing the range query of every container
+			if points := int64(historyWindow/historyStep) + 1; points > maxRangeQueryPoints {
+				return fmt.Errorf("history %s at a step of %s gives %d points, more than the %d Prometheus allows: use a larger --history-step",
+					history, formatPrometheusDuration(historyStep), points, maxRangeQueryPoints)
+			}
+		}
+		return validateTimeWindow(timeWindow)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		opts := recommendOptionsFromFlags()
+		namespaces, err := namespacesFromFlags(cmd)
 		if err != nil {
-			panic(err.Error())
+			return err
+		}
+		if err := validateNamespacesExist(cmd, namespaces); err != nil {
+			return err
 		}
 
-		// Get all Deployments in the namespace
-		deployments, err := clientset.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+		clientset, err := newKubernetesClient()
 		if err != nil {
-			panic(err.Error())
+			return err
 		}
 
-		// Iterate through the Deployments and print recommendations
-		for _, deployment := range deployments.Items {
-			fmt.Printf("Deployment: %s\n", deployment.Name)
-			printContainerRecommendations("InitContainer", deployment.Spec.Template.Spec.InitContainers, namespace, clientset)
-			printContainerRecommendations("Container", deployment.Spec.Template.Spec.Containers, namespace, clientset)
+		// Recommendations are per workload, so all namespaces means every namespace in the cluster
+		if len(namespaces) == 1 && namespaces[0] == "" {
+			namespaceList, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return fmt.Errorf("listing namespaces: %w", err)
+			}
+			namespaces = nil
+			for _, ns := range namespaceList.Items {
+				namespaces = append(namespaces, ns.Name)
+			}
+		}
+		if opts.historyWindow > 0 {
+			if err := confirmExpensiveQuery(namespaces, opts.historyWindow, opts.historyStep); err != nil {
+				return err
+			}
 		}
 
-		// Get all StatefulSets in the namespace
-		statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
-			panic(err.Error())
+		// Namespaces that failed are reported after the results of the others
+		results, namespaceErr := runPerNamespace(namespaces, func(namespace string) (recommendation, error) {
+			return recommendNamespace(ctx, namespace, clientset, opts)
+		})
+		if len(results) == 0 && namespaceErr != nil {
+			return namespaceErr
 		}
 
-		// Iterate through the StatefulSets and print recommendations
-		for _, statefulSet := range statefulSets.Items {
-			fmt.Printf("StatefulSet: %s\n", statefulSet.Name)
-			printContainerRecommendations("InitContainer", statefulSet.Spec.Template.Spec.InitContainers, namespace, clientset)
-			printContainerRecommendations("Container", statefulSet.Spec.Template.Spec.Containers, namespace, clientset)
+		// A single namespace is rendered as an object to keep the output of single-namespace runs unchanged
+		if outputFormat == "json" {
+			if len(namespaces) == 1 {
+				err = printJSON(results[0])
+			} else {
+				err = printJSON(results)
+			}
+			if err != nil {
+				return err
+			}
+		} else if outputFormat == "yaml" {
+			for _, result := range results {
+				if err := printRecommendationYAML(result); err != nil {
+					return err
+				}
+			}
+		} else {
+			for i, result := range results {
+				if len(namespaces) > 1 {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Printf("Namespace: %s\n", result.Namespace)
+				}
+				if outputFormat == "table" {
+					printRecommendationTable(result, opts)
+				} else {
+					printRecommendation(result)
+				}
+			}
 		}
 
-		// Recommend resource quotas and limit ranges if requested
-		if recommendQuotas {
-			recommendResourceQuotas(namespace)
+		var overProvisioned []string
+		for _, result := range results {
+			for _, workload := range result.Workloads {
+				for _, container := range workload.Containers {
+					if container.OverProvisioned {
+						overProvisioned = append(overProvisioned, fmt.Sprintf("container %s of %s %s/%s", container.Name, workload.Kind, result.Namespace, workload.Name))
+					}
+				}
+			}
 		}
-		if recommendLimitRanges {
-			recommendLimitRangesFunc(namespace)
+		resourceErr := checkResourceResults(ctx, results, opts)
+		if namespaceErr == nil && resourceErr == nil {
+			return overProvisionedError(overProvisioned)
 		}
+		return errors.Join(namespaceErr, resourceErr)
 	},
 }
 
-// queryPrometheus queries Prometheus for the container's CPU and memory usage percentile
-func queryPrometheus(namespace, container string) (cpuAvg, cpuMax, memoryAvg, memoryMax float64) {
-	if timeWindow == "" {
-		timeWindow = "30m" // Default to 30 minutes
+// newKubernetesClient creates a Kubernetes client from the default kubeconfig
+func newKubernetesClient() (*kubernetes.Clientset, error) {
+	// Load kubeconfig
+	kubeconfig := clientcmd.NewDefaultClientConfigLoadingRules().GetDefaultFilename()
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+
+	// Create Kubernetes client
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating Kubernetes client: %w", err)
+	}
+	return clientset, nil
+}
+
+// recommendNamespace collects the recommendations for a namespace, or for a single pod in it if one was requested
+func recommendNamespace(ctx context.Context, namespace string, clientset kubernetes.Interface, opts recommendOptions) (recommendation, error) {
+	result := recommendation{Namespace: namespace}
+
+	// Recommend for the containers of a single pod if one was requested
+	if opts.pod != "" {
+		p, err := clientset.CoreV1().Pods(namespace).Get(ctx, opts.pod, metav1.GetOptions{})
+		if err != nil {
+			return result, fmt.Errorf("getting pod %s/%s: %w", namespace, opts.pod, err)
+		}
+
+		result.Workloads = append(result.Workloads, workloadRecommendation{
+			Kind:       "Pod",
+			Name:       p.Name,
+			Containers: containerRecommendations(ctx, p.Spec.InitContainers, p.Spec.Containers, namespace, opts),
+		})
+	} else {
+		workloads, err := workloadRecommendations(ctx, namespace, clientset, opts)
+		if err != nil {
+			return result, err
+		}
+		result.Workloads = workloads
+	}
+	if hasUsageData(result.Workloads) {
+		checkUsageStaleness(ctx, namespace)
 	}
 
-	// Ensure both percentiles have values; if not, use the cpuPercentile for memory as well
-	if memoryPercentile == 0 {
-		memoryPercentile = cpuPercentile // Default memory to use the same percentile as CPU
+	// Recommend resource quotas and limit ranges if requested
+	if opts.quotas {
+		result.ResourceQuota = recommendResourceQuotas(namespace)
+	}
+	if opts.limitRanges {
+		result.LimitRange = recommendLimitRangesFunc(namespace)
 	}
 
-	// Construct Prometheus queries for CPU percentile
-	cpuAvgQuery := fmt.Sprintf(
-		`quantile_over_time(0.5, node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace="%s", container="%s"}[%s])`,
-		namespace, container, timeWindow,
-	)
-	cpuMaxQuery := fmt.Sprintf(
-		`quantile_over_time(%.2f, node_namespace_pod_container:container_cpu_usage_seconds_total:sum_irate{namespace="%s", container="%s"}[%s])`,
-		cpuPercentile, namespace, container, timeWindow,
-	)
+	return result, nil
+}
+
+// resourceValues holds CPU and memory quantities in Kubernetes manifest notation
+type resourceValues struct {
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
+
+// resourceRequirements mirrors the limits and requests stanza of a container spec
+type resourceRequirements struct {
+	Limits   resourceValues `json:"limits"`
+	Requests resourceValues `json:"requests"`
+}
+
+// containerRecommendation holds the current and recommended resources of a container or initContainer
+type containerRecommendation struct {
+	Type        string               `json:"type"`
+	Name        string               `json:"name"`
+	Current     resourceRequirements `json:"current"`
+	Recommended resourceRequirements `json:"recommended"`
+	NoData      []string             `json:"noData,omitempty"` // Resources Prometheus returned no usage data for
+	// OverProvisioned is set when the CPU usage at --request-percentile is below --fail-over-ratio of the CPU request
+	OverProvisioned bool `json:"overProvisioned,omitempty"`
+	// resources holds the recommendation as quantities for rendering manifest snippets
+	resources corev1.ResourceRequirements
+	// queryErrors holds why querying the usage of a resource in NoData failed, by resource name
+	queryErrors map[string]error
+}
 
-	// Construct Prometheus queries for Memory percentile
-	memoryAvgQuery := fmt.Sprintf(
-		`quantile_over_time(0.5, container_memory_usage_bytes{namespace="%s", container="%s"}[%s]) / (1024 * 1024 * 1024)`, // Convert to GiB
-		namespace, container, timeWindow,
-	)
-	memoryMaxQuery := fmt.Sprintf(
-		`quantile_over_time(%.2f, container_memory_usage_bytes{namespace="%s", container="%s"}[%s]) / (1024 * 1024 * 1024)`, // Convert to GiB
-		memoryPercentile, namespace, container, timeWindow,
-	)
+// workloadRecommendation groups the container recommendations of a Deployment, StatefulSet or Pod
+type workloadRecommendation struct {
+	Kind       string                    `json:"kind"`
+	Name       string                    `json:"name"`
+	Containers []containerRecommendation `json:"containers"`
+}
 
-	// Query Prometheus
-	cpuAvg = queryPrometheusMetric(cpuAvgQuery)
-	cpuMax = queryPrometheusMetric(cpuMaxQuery)
-	memoryAvg = queryPrometheusMetric(memoryAvgQuery)
-	memoryMax = queryPrometheusMetric(memoryMaxQuery)
+// limitRangeRecommendation holds the recommended limit range for a namespace
+type limitRangeRecommendation struct {
+	Min            resourceValues `json:"min"`
+	Max            resourceValues `json:"max"`
+	Default        resourceValues `json:"default"`
+	DefaultRequest resourceValues `json:"defaultRequest"`
+}
 
-	return cpuAvg, cpuMax, memoryAvg, memoryMax
+// recommendation is the complete output of the recommend command for a namespace
+type recommendation struct {
+	Namespace     string                    `json:"namespace"`
+	Workloads     []workloadRecommendation  `json:"workloads"`
+	ResourceQuota map[string]string         `json:"resourceQuota,omitempty"`
+	LimitRange    *limitRangeRecommendation `json:"limitRange,omitempty"`
 }
 
-func queryPrometheusMetric(query string) float64 {
-	// URL-encode the entire query
-	encodedQuery := url.QueryEscape(query)
+// workloadRecommendations returns recommendations for every Deployment and StatefulSet in the namespace
+func workloadRecommendations(ctx context.Context, namespace string, clientset kubernetes.Interface, opts recommendOptions) ([]workloadRecommendation, error) {
+	var workloads []workloadRecommendation
 
-	// Construct the full URL for the Prometheus API
-	fullURL := fmt.Sprintf("%s/api/v1/query?query=%s", prometheusURL, encodedQuery)
+	// Get all Deployments in the namespace
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing deployments in namespace %s: %w", namespace, err)
+	}
 
-	if debug {
-		// Log the full URL for debugging
-		fmt.Printf("Full Prometheus query URL: %s\n", fullURL)
+	// Iterate through the Deployments and collect recommendations
+	for _, deployment := range deployments.Items {
+		workloads = append(workloads, workloadRecommendation{
+			Kind:       "Deployment",
+			Name:       deployment.Name,
+			Containers: containerRecommendations(ctx, deployment.Spec.Template.Spec.InitContainers, deployment.Spec.Template.Spec.Containers, namespace, opts),
+		})
 	}
 
-	// Send the HTTP GET request to Prometheus
-	resp, err := http.Get(fullURL)
+	// Get all StatefulSets in the namespace
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Printf("Error querying Prometheus: %v\n", err)
-		return 0
+		return nil, fmt.Errorf("listing statefulsets in namespace %s: %w", namespace, err)
 	}
-	defer resp.Body.Close()
 
-	if debug {
-		// Log the response status for debugging
-		fmt.Printf("Prometheus response status: %s\n", resp.Status)
+	// Iterate through the StatefulSets and collect recommendations
+	for _, statefulSet := range statefulSets.Items {
+		workloads = append(workloads, workloadRecommendation{
+			Kind:       "StatefulSet",
+			Name:       statefulSet.Name,
+			Containers: containerRecommendations(ctx, statefulSet.Spec.Template.Spec.InitContainers, statefulSet.Spec.Template.Spec.Containers, namespace, opts),
+		})
 	}
 
-	// Check if the response status is not 200 OK
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Received non-OK HTTP status: %s\n", resp.Status)
-		return 0
+	return workloads, nil
+}
+
+// hasUsageData reports whether Prometheus returned usage data for any container of the workloads
+func hasUsageData(workloads []workloadRecommendation) bool {
+	for _, workload := range workloads {
+		for _, container := range workload.Containers {
+			if len(container.resources.Requests) > 0 {
+				return true
+			}
+		}
 	}
+	return false
+}
+
+// validateResource checks that the requested resource is one of cpu, memory or both
+func validateResource(resource string) error {
+	switch resource {
+	case "cpu", "memory", "both":
+		return nil
+	case "gpu":
+		// GPUs can't be overcommitted, so usage percentiles say nothing about how many to request
+		return fmt.Errorf("GPU recommendations are not supported since GPUs are requested as whole devices: use analyze --resource gpu to report GPU usage")
+	}
+	return fmt.Errorf("invalid resource %q: must be one of cpu, memory, both", resource)
+}
+
+// validatePercentile checks that a percentile is expressed as a quantile between 0 and 1
+func validatePercentile(name string, percentile float64) error {
+	if percentile <= 0 || percentile > 1 {
+		return fmt.Errorf("invalid %s %g: must be a quantile greater than 0 and at most 1 (e.g. 0.95)", name, percentile)
+	}
+	return nil
+}
+
+// prometheusDurationPattern matches Prometheus duration strings such as 30m, 7d or 1h30m
+var prometheusDurationPattern = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|y))+$`)
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+// validateTimeWindow checks that the time window is a valid Prometheus duration
+func validateTimeWindow(window string) error {
+	if !prometheusDurationPattern.MatchString(window) {
+		return fmt.Errorf("invalid time window %q: must be a Prometheus duration such as 30m, 1d or 7d", window)
+	}
+	return nil
+}
+
+// includesCPU reports whether CPU recommendations were requested
+func (o recommendOptions) includesCPU() bool {
+	return o.resource == "cpu" || o.resource == "both"
+}
+
+// includesMemory reports whether memory recommendations were requested
+func (o recommendOptions) includesMemory() bool {
+	return o.resource == "memory" || o.resource == "both"
+}
+
+// containerSelector returns the label matchers for a container, narrowed to pod if it is set
+func containerSelector(namespace, container, pod string) string {
+	podMatcher := ""
+	if pod != "" {
+		podMatcher = "pod=" + strconv.Quote(pod)
+	}
+	return labelSelector(namespaceMatcher(namespace), "container="+strconv.Quote(container), podMatcher)
+}
+
+// containerUsage holds the usage percentiles of a container as reported by Prometheus
+type containerUsage struct {
+	cpuRequest, cpuLimit       float64 // Cores at the request and CPU limit percentiles
+	memoryRequest, memoryLimit float64 // Bytes at the request and memory limit percentiles
+	hasCPU, hasMemory          bool    // Whether Prometheus returned data for the resource
+	cpuErr, memoryErr          error   // Why querying the resource failed, nil when it didn't
+}
+
+// queryPrometheus queries Prometheus for the container's CPU and memory usage percentile
+func queryPrometheus(ctx context.Context, namespace, container string, opts recommendOptions) containerUsage {
+	selector := containerSelector(namespace, container, opts.pod)
+
+	// Query Prometheus, skipping the resources that were not requested
+	var usage containerUsage
+	if opts.historyWindow > 0 {
+		usage = queryUsageHistory(ctx, selector, opts)
+	} else {
+		usage = queryUsagePercentiles(ctx, selector, opts)
+	}
+
+	// A limit below the request would be rejected by the API server, which happens when the limit percentile is lower
+	if usage.hasCPU && usage.cpuLimit < usage.cpuRequest {
+		fmt.Fprintf(os.Stderr, "Warning: CPU limit of container %s in namespace %s is below its request, raising it to the request\n", container, namespace)
+		usage.cpuLimit = usage.cpuRequest
+	}
+	if usage.hasMemory && usage.memoryLimit < usage.memoryRequest {
+		fmt.Fprintf(os.Stderr, "Warning: memory limit of container %s in namespace %s is below its request, raising it to the request\n", container, namespace)
+		usage.memoryLimit = usage.memoryRequest
+	}
+
+	return usage
+}
+
+// queryUsagePercentiles computes the usage percentiles of the containers matching selector over the time window
+// with quantile_over_time
+func queryUsagePercentiles(ctx context.Context, selector string, opts recommendOptions) containerUsage {
+	queries := map[string]string{}
+	if opts.includesCPU() {
+		queries["cpu_request"] = containerCPUPercentileQuery(selector, opts.requestPercentile, opts.timeWindow)
+		queries["cpu_limit"] = containerCPUPercentileQuery(selector, opts.cpuPercentile, opts.timeWindow)
+	}
+	if opts.includesMemory() {
+		queries["memory_request"] = containerMemoryPercentileQuery(selector, opts.requestPercentile, opts.timeWindow)
+		queries["memory_limit"] = containerMemoryPercentileQuery(selector, opts.memoryPercentile, opts.timeWindow)
+	}
+
+	// The percentiles are fetched in one round-trip, or one query at a time to find out which failed
+	var errs map[string]error
+	values, err := queryPrometheusBatch(ctx, queries)
 	if err != nil {
-		fmt.Printf("Error reading Prometheus response body: %v\n", err)
-		return 0
+		logger.Debug("Batched usage query failed, running its queries one by one", "error", err)
+		values, errs = queryPrometheusEach(ctx, queries)
 	}
 
-	if debug {
-		// Log the raw response body for debugging
-		fmt.Printf("Raw Prometheus response: %s\n", string(body))
+	usage := containerUsage{
+		cpuErr:    cmp.Or(errs["cpu_request"], errs["cpu_limit"]),
+		memoryErr: cmp.Or(errs["memory_request"], errs["memory_limit"]),
 	}
+	var requestFound, limitFound bool
+	usage.cpuRequest, requestFound = values["cpu_request"]
+	usage.cpuLimit, limitFound = values["cpu_limit"]
+	usage.hasCPU = requestFound && limitFound
+	usage.memoryRequest, requestFound = values["memory_request"]
+	usage.memoryLimit, limitFound = values["memory_limit"]
+	usage.hasMemory = requestFound && limitFound
+	return usage
+}
 
-	// Unmarshal the JSON response
-	var result struct {
-		Status string `json:"status"`
-		Data   struct {
-			ResultType string `json:"resultType"`
-			Results    []struct {
-				Value []interface{} `json:"value"`
-			} `json:"result"`
-		} `json:"data"`
+// containerRecommendations returns resource recommendations for the initContainers and containers of a pod spec
+func containerRecommendations(ctx context.Context, initContainers, containers []corev1.Container, namespace string, opts recommendOptions) []containerRecommendation {
+	var recommendations []containerRecommendation
+	for _, container := range initContainers {
+		recommendations = append(recommendations, recommendContainer(ctx, "InitContainer", container, namespace, opts))
 	}
+	for _, container := range containers {
+		recommendations = append(recommendations, recommendContainer(ctx, "Container", container, namespace, opts))
+	}
+	return recommendations
+}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		fmt.Printf("Error parsing Prometheus response: %v\n", err)
-		return 0
+// recommendContainer compares a container's current resources with its usage in Prometheus
+func recommendContainer(ctx context.Context, containerType string, container corev1.Container, namespace string, opts recommendOptions) containerRecommendation {
+	// Query Prometheus for the container's resource usage
+	usage := queryPrometheus(ctx, namespace, container.Name, opts)
+
+	// Record current resource requests and limits
+	requests := container.Resources.Requests
+	limits := container.Resources.Limits
+	rec := containerRecommendation{
+		Type: containerType,
+		Name: container.Name,
+		Current: resourceRequirements{
+			Limits:   resourceValues{CPU: limits.Cpu().String(), Memory: limits.Memory().String()},
+			Requests: resourceValues{CPU: requests.Cpu().String(), Memory: requests.Memory().String()},
+		},
+		resources:   corev1.ResourceRequirements{Limits: corev1.ResourceList{}, Requests: corev1.ResourceList{}},
+		queryErrors: map[string]error{},
 	}
 
-	if result.Status != "success" || len(result.Data.Results) == 0 {
-		return 0
+	// Round the Prometheus metrics plus headroom up to Kubernetes quantities, noting resources without data. The
+	// recommendations are printed as these quantities so that every output format agrees with the yaml stanzas.
+	if opts.includesCPU() {
+		if usage.hasCPU {
+			rec.resources.Requests[corev1.ResourceCPU] = cpuQuantity(applyHeadroom(usage.cpuRequest, opts.headroom), opts.cpuRound)
+			rec.resources.Limits[corev1.ResourceCPU] = cpuQuantity(applyHeadroom(usage.cpuLimit, opts.headroom), opts.cpuRound)
+			rec.Recommended.Requests.CPU = rec.resources.Requests.Cpu().String()
+			rec.Recommended.Limits.CPU = rec.resources.Limits.Cpu().String()
+			rec.OverProvisioned = opts.failOverRatio > 0 && evaluateThreshold(usage.cpuRequest, requests.Cpu().AsApproximateFloat64(), opts.failOverRatio)
+		} else {
+			rec.NoData = append(rec.NoData, "cpu")
+			if usage.cpuErr != nil {
+				rec.queryErrors["cpu"] = usage.cpuErr
+			}
+		}
+	}
+	if opts.includesMemory() {
+		if usage.hasMemory {
+			rec.resources.Requests[corev1.ResourceMemory] = memoryQuantity(applyHeadroom(usage.memoryRequest, opts.headroom), opts.memoryRound)
+			rec.resources.Limits[corev1.ResourceMemory] = memoryQuantity(applyHeadroom(usage.memoryLimit, opts.headroom), opts.memoryRound)
+			rec.Recommended.Requests.Memory = rec.resources.Requests.Memory().String()
+			rec.Recommended.Limits.Memory = rec.resources.Limits.Memory().String()
+		} else {
+			rec.NoData = append(rec.NoData, "memory")
+			if usage.memoryErr != nil {
+				rec.queryErrors["memory"] = usage.memoryErr
+			}
+		}
 	}
 
-	// Extract the value from the first result
-	value := result.Data.Results[0].Value[1]
-	var floatValue float64
-	switch v := value.(type) {
-	case string:
-		if _, err := fmt.Sscanf(v, "%f", &floatValue); err != nil {
-			fmt.Printf("Error converting Prometheus value to float: %v\n", err)
-			return 0
+	return rec
+}
+
+// checkResourceResults warns about the requested resources that some containers have no recommendation for
+// because querying their usage failed, or because no container has usage data for them while other resources do,
+// as when cAdvisor memory metrics are disabled. It returns an error only when querying every resource failed.
+func checkResourceResults(ctx context.Context, results []recommendation, opts recommendOptions) error {
+	// An interrupt is reported once when the command exits rather than as failed queries
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	var requested []string
+	if opts.includesCPU() {
+		requested = append(requested, "cpu")
+	}
+	if opts.includesMemory() {
+		requested = append(requested, "memory")
+	}
+
+	containers := 0
+	withData := map[string]int{}
+	failed := map[string]int{}
+	firstErr := map[string]error{}
+	for _, result := range results {
+		for _, workload := range result.Workloads {
+			for _, container := range workload.Containers {
+				containers++
+				for _, name := range requested {
+					if err, ok := container.queryErrors[name]; ok {
+						failed[name]++
+						if firstErr[name] == nil {
+							firstErr[name] = err
+						}
+					} else if !slices.Contains(container.NoData, name) {
+						withData[name]++
+					}
+				}
+			}
 		}
-	case float64:
-		floatValue = v
-	default:
-		fmt.Printf("Unexpected value type: %T\n", v)
+	}
+
+	var succeeded, failedResources []string
+	for _, name := range requested {
+		if withData[name] > 0 {
+			succeeded = append(succeeded, name)
+		}
+		if failed[name] > 0 && withData[name] == 0 {
+			failedResources = append(failedResources, name)
+		}
+	}
+	for _, name := range requested {
+		switch {
+		case failed[name] > 0:
+			fmt.Fprintf(os.Stderr, "Warning: querying %s usage failed for %d of %d containers: %v\n",
+				resourceDisplayName(name), failed[name], containers, firstErr[name])
+		case withData[name] == 0 && len(succeeded) > 0:
+			fmt.Fprintf(os.Stderr, "Warning: no %s usage data found for any container, the metric may not be collected\n",
+				resourceDisplayName(name))
+		}
+	}
+
+	if len(failedResources) > 0 && len(failedResources) == len(requested) {
+		return fmt.Errorf("querying usage failed for every requested resource")
+	}
+	return nil
+}
+
+// printRecommendation prints the recommendation for a namespace in text format
+func printRecommendation(result recommendation) {
+	for _, workload := range result.Workloads {
+		fmt.Printf("%s: %s\n", workload.Kind, workload.Name)
+		for _, container := range workload.Containers {
+			printContainerRecommendation(container)
+		}
+	}
+
+	if result.ResourceQuota != nil {
+		printResourceQuota(result.ResourceQuota)
+	}
+	if result.LimitRange != nil {
+		printLimitRange(result.LimitRange)
+	}
+}
+
+// printRecommendationYAML prints the recommendation for a namespace with --output yaml: a resources stanza ready to
+// paste into the container spec of every container with usage data, as separate YAML documents headed by a comment
+// naming the workload and container. Containers without usage data are listed as comments only.
+func printRecommendationYAML(result recommendation) error {
+	for _, workload := range result.Workloads {
+		for _, container := range workload.Containers {
+			if len(container.resources.Requests) == 0 {
+				fmt.Printf("# No usage data found for %s %s/%s, container %s\n", workload.Kind, result.Namespace, workload.Name, container.Name)
+				continue
+			}
+			snippet, err := renderResourceYAML(container.resources)
+			if err != nil {
+				return err
+			}
+			fmt.Println("---")
+			fmt.Printf("# %s %s/%s, container %s\n", workload.Kind, result.Namespace, workload.Name, container.Name)
+			fmt.Print(snippet)
+		}
+	}
+	return nil
+}
+
+// renderResourceYAML renders resource requirements as a resources stanza of a container spec
+func renderResourceYAML(resources corev1.ResourceRequirements) (string, error) {
+	out, err := yaml.Marshal(map[string]corev1.ResourceRequirements{"resources": resources})
+	if err != nil {
+		return "", fmt.Errorf("rendering resources: %w", err)
+	}
+	return string(out), nil
+}
+
+// applyHeadroom adds a safety buffer of headroom, a fraction such as 0.2 for 20%, to a usage percentile.
+// Usage that is negative or not a number, which Prometheus can return for counter resets, is clamped to 0.
+func applyHeadroom(base, headroom float64) float64 {
+	if math.IsNaN(base) || base <= 0 {
 		return 0
 	}
+	return base * (1 + headroom)
+}
+
+// The increments recommendations are rounded up to, parsed from --cpu-round and --mem-round
+var (
+	cpuRoundIncrement    = k8sresource.MustParse("10m")
+	memoryRoundIncrement = k8sresource.MustParse("1Mi")
+)
+
+// parseRoundIncrement parses the value of a rounding flag, which must be a positive quantity
+func parseRoundIncrement(flag, value string) (k8sresource.Quantity, error) {
+	increment, err := k8sresource.ParseQuantity(value)
+	if err != nil {
+		return k8sresource.Quantity{}, fmt.Errorf("invalid --%s %q: %w", flag, value, err)
+	}
+	if increment.Sign() <= 0 {
+		return k8sresource.Quantity{}, fmt.Errorf("invalid --%s %q: must be positive", flag, value)
+	}
+	return increment, nil
+}
 
-	return floatValue
+// roundUpQuantity rounds q up to the next multiple of increment, leaving multiples unchanged. The result is
+// formatted like increment. Values below a millicore of precision are rounded up to one first.
+func roundUpQuantity(q, increment k8sresource.Quantity) k8sresource.Quantity {
+	step := increment.MilliValue()
+	steps := q.MilliValue() / step
+	if q.MilliValue()%step != 0 {
+		steps++
+	}
+	return *k8sresource.NewMilliQuantity(steps*step, increment.Format)
 }
 
-// printContainerRecommendations prints resource recommendations for a slice of containers or initContainers
-func printContainerRecommendations(containerType string, containers []corev1.Container, namespace string, clientset *kubernetes.Clientset) {
-	for _, container := range containers {
-		fmt.Printf("  %s: %s\n", containerType, container.Name)
+// cpuQuantity converts cores to a quantity rounded up to increment, and at least one increment
+func cpuQuantity(cores float64, increment k8sresource.Quantity) k8sresource.Quantity {
+	// The epsilon keeps floating point noise such as 0.25*1000 = 250.00000000000003 from rounding up a step
+	millicores := int64(math.Ceil(max(cores, 0)*1000 - 1e-6))
+	q := roundUpQuantity(*k8sresource.NewMilliQuantity(millicores, k8sresource.DecimalSI), increment)
+	return maxQuantity(q, increment)
+}
+
+// memoryQuantity converts bytes to a quantity rounded up to increment, and at least one increment
+func memoryQuantity(bytes float64, increment k8sresource.Quantity) k8sresource.Quantity {
+	q := roundUpQuantity(*k8sresource.NewQuantity(int64(math.Ceil(max(bytes, 0)-1e-6)), k8sresource.BinarySI), increment)
+	return maxQuantity(q, increment)
+}
+
+// maxQuantity returns the larger of two quantities
+func maxQuantity(a, b k8sresource.Quantity) k8sresource.Quantity {
+	if a.Cmp(b) < 0 {
+		return b
+	}
+	return a
+}
+
+// printRecommendationTable prints one row per container and resource, followed by any quota or limit range
+func printRecommendationTable(result recommendation, opts recommendOptions) {
+	var rows [][]string
+	for _, workload := range result.Workloads {
+		for _, container := range workload.Containers {
+			name := workload.Kind + "/" + workload.Name
+			if opts.includesCPU() {
+				rows = append(rows, []string{
+					name, container.Name, "cpu",
+					container.Current.Requests.CPU, orNoData(container.Recommended.Requests.CPU),
+					container.Current.Limits.CPU, orNoData(container.Recommended.Limits.CPU),
+				})
+			}
+			if opts.includesMemory() {
+				rows = append(rows, []string{
+					name, container.Name, "memory",
+					container.Current.Requests.Memory, orNoData(container.Recommended.Requests.Memory),
+					container.Current.Limits.Memory, orNoData(container.Recommended.Limits.Memory),
+				})
+			}
+		}
+	}
+	fmt.Print(renderTable([]string{"WORKLOAD", "CONTAINER", "RESOURCE", "REQUEST", "RECOMMENDED REQUEST", "LIMIT", "RECOMMENDED LIMIT"}, rows))
+
+	if result.ResourceQuota != nil {
+		printResourceQuota(result.ResourceQuota)
+	}
+	if result.LimitRange != nil {
+		printLimitRange(result.LimitRange)
+	}
+}
 
-		// Query Prometheus for the container's resource usage
-		cpuAvg, cpuMax, memoryAvg, memoryMax := queryPrometheus(namespace, container.Name)
+// orNoData returns the value, or a placeholder when Prometheus returned no data for it
+func orNoData(value string) string {
+	if value == "" {
+		return "no data"
+	}
+	return value
+}
 
-		// Print current resource requests and limits
-		requests := container.Resources.Requests
-		limits := container.Resources.Limits
-		fmt.Printf("    Requests: CPU=%s, Memory=%s\n", requests.Cpu().String(), requests.Memory().String())
-		fmt.Printf("    Limits:   CPU=%s, Memory=%s\n", limits.Cpu().String(), limits.Memory().String())
+// printContainerRecommendation prints the current and recommended resources of a container
+func printContainerRecommendation(rec containerRecommendation) {
+	fmt.Printf("  %s: %s\n", rec.Type, rec.Name)
 
-		// Format the Prometheus metrics into Kubernetes manifest compatible units
-		recommendedCPURequest := formatCPU(cpuAvg)          // Convert from cores to millicores or cores
-		recommendedMemoryRequest := formatMemory(memoryAvg) // Convert from GiB to MiB
-		recommendedCPULimit := formatCPU(cpuMax)            // Convert from cores to millicores or cores
-		recommendedMemoryLimit := formatMemory(memoryMax)   // Convert from GiB to MiB
+	// Print current resource requests and limits
+	fmt.Printf("    Requests: CPU=%s, Memory=%s\n", rec.Current.Requests.CPU, rec.Current.Requests.Memory)
+	fmt.Printf("    Limits:   CPU=%s, Memory=%s\n", rec.Current.Limits.CPU, rec.Current.Limits.Memory)
 
-		// Print recommended resources in Kubernetes manifest format
-		fmt.Println("    Recommended resources:")
-		fmt.Println("        limits:")
-		fmt.Printf("          cpu: %s\n", recommendedCPULimit)
-		fmt.Printf("          memory: %s\n", recommendedMemoryLimit)
-		fmt.Println("        requests:")
-		fmt.Printf("          cpu: %s\n", recommendedCPURequest)
-		fmt.Printf("          memory: %s\n", recommendedMemoryRequest)
+	for _, name := range rec.NoData {
+		fmt.Printf("    No %s usage data found (no running pods or metric unavailable)\n", resourceDisplayName(name))
 	}
+	if rec.Recommended.Limits == (resourceValues{}) && rec.Recommended.Requests == (resourceValues{}) {
+		return
+	}
+
+	// Print recommended resources in Kubernetes manifest format
+	fmt.Println("    Recommended resources:")
+	fmt.Println("        limits:")
+	printResourceValues("          ", rec.Recommended.Limits)
+	fmt.Println("        requests:")
+	printResourceValues("          ", rec.Recommended.Requests)
 }
 
-// formatCPU formats CPU usage to Kubernetes-compatible units
-func formatCPU(cpu float64) string {
-	if cpu < 0.001 {
-		return "1m" // Handle very small values
-	} else if cpu < 0.1 {
-		return fmt.Sprintf("%.0fm", cpu*1000) // Convert to millicores
-	} else if cpu < 1 {
-		return fmt.Sprintf("%.0fm", cpu*1000) // Convert to millicores
+// resourceDisplayName returns the name of a resource as it is written in prose
+func resourceDisplayName(name string) string {
+	if name == "cpu" {
+		return "CPU"
 	}
-	return fmt.Sprintf("%.0f", cpu) // Convert to cores
+	return name
 }
 
-// formatMemory formats memory usage to Kubernetes-compatible units
-func formatMemory(memory float64) string {
-	if memory >= 1024 {
-		return fmt.Sprintf("%.0fGi", memory/1024) // Convert from MiB to GiB
+// printResourceValues prints the CPU and memory values that are set, one per line
+func printResourceValues(indent string, values resourceValues) {
+	if values.CPU != "" {
+		fmt.Printf("%scpu: %s\n", indent, values.CPU)
+	}
+	if values.Memory != "" {
+		fmt.Printf("%smemory: %s\n", indent, values.Memory)
 	}
-	return fmt.Sprintf("%.0fMi", memory) // Use MiB for smaller values
 }
 
 // recommendResourceQuotas recommends resource quotas for the namespace
-func recommendResourceQuotas(namespace string) {
+func recommendResourceQuotas(namespace string) map[string]string {
 	// Example logic for recommending resource quotas
+	return map[string]string{
+		"cpu":        "4",
+		"memory":     "8Gi",
+		"pods":       "10",
+		"configmaps": "10",
+		"secrets":    "10",
+	}
+}
+
+// printResourceQuota prints the recommended resource quota in Kubernetes manifest format
+func printResourceQuota(hard map[string]string) {
 	fmt.Println("Recommended Resource Quotas:")
 	fmt.Println("  hard:")
-	fmt.Println("    cpu: 4")
-	fmt.Println("    memory: 8Gi")
-	fmt.Println("    pods: 10")
-	fmt.Println("    configmaps: 10")
-	fmt.Println("    secrets: 10")
+	for _, name := range []string{"cpu", "memory", "pods", "configmaps", "secrets"} {
+		fmt.Printf("    %s: %s\n", name, hard[name])
+	}
 }
 
 // recommendLimitRangesFunc recommends limit ranges for the namespace
-func recommendLimitRangesFunc(namespace string) {
+func recommendLimitRangesFunc(namespace string) *limitRangeRecommendation {
 	// Example suggested values (could be based on data from Prometheus or other sources)
 	suggestedMinCPU := "50m"
 	suggestedMinMemory := "50Mi"
@@ -303,21 +863,26 @@ func recommendLimitRangesFunc(namespace string) {
 	// Compute the maximum memory value from the suggested values
 	maxMemory := max(minMemoryMiB, maxMemoryMiB, defaultMemoryMiB, defaultRequestMemoryMiB)
 
-	// Print the recommended limit ranges
+	return &limitRangeRecommendation{
+		Min:            resourceValues{CPU: suggestedMinCPU, Memory: suggestedMinMemory},
+		Max:            resourceValues{CPU: suggestedMaxCPU, Memory: formatMemory(maxMemory * mebibyte)}, // Format the max memory value
+		Default:        resourceValues{CPU: suggestedDefaultCPU, Memory: suggestedDefaultMemory},
+		DefaultRequest: resourceValues{CPU: suggestedDefaultRequestCPU, Memory: suggestedDefaultRequestMemory},
+	}
+}
+
+// printLimitRange prints the recommended limit range in Kubernetes manifest format
+func printLimitRange(limitRange *limitRangeRecommendation) {
 	fmt.Println("Recommended Limit Ranges:")
 	fmt.Println("  limits:")
 	fmt.Println("    min:")
-	fmt.Printf("      cpu: %s\n", suggestedMinCPU)
-	fmt.Printf("      memory: %s\n", suggestedMinMemory)
+	printResourceValues("      ", limitRange.Min)
 	fmt.Println("    max:")
-	fmt.Printf("      cpu: %s\n", suggestedMaxCPU)
-	fmt.Printf("      memory: %s\n", formatMemory(maxMemory)) // Format the max memory value
+	printResourceValues("      ", limitRange.Max)
 	fmt.Println("    default:")
-	fmt.Printf("      cpu: %s\n", suggestedDefaultCPU)
-	fmt.Printf("      memory: %s\n", suggestedDefaultMemory)
+	printResourceValues("      ", limitRange.Default)
 	fmt.Println("    defaultRequest:")
-	fmt.Printf("      cpu: %s\n", suggestedDefaultRequestCPU)
-	fmt.Printf("      memory: %s\n", suggestedDefaultRequestMemory)
+	printResourceValues("      ", limitRange.DefaultRequest)
 }
 
 // convertMemoryToMiB converts a memory value in string format to MiB
@@ -352,11 +917,23 @@ func max(values ...float64) float64 {
 func init() {
 	rootCmd.AddCommand(recommendCmd)
 
-	recommendCmd.Flags().StringP("namespace", "n", "", "The namespace to get Deployments and StatefulSets from (default is 'default')")
-	recommendCmd.Flags().BoolVarP(&debug, "debug", "d", false, "Enable debug output")
-	recommendCmd.Flags().StringP("timewindow", "t", "1d", "Time window for Prometheus queries (default is '30m')")
-	recommendCmd.Flags().Float64Var(&cpuPercentile, "cpu-percentile", 0.99, "Percentile to use for CPU resource limits (default is 99th percentile)")
-	recommendCmd.Flags().Float64Var(&memoryPercentile, "memory-percentile", 0.99, "Percentile to use for memory resource limits (default is 99th percentile)")
+	addNamespaceFlags(recommendCmd)
+	recommendCmd.Flags().BoolVarP(&debug, "debug", "d", false, "Enable debug output (same as --log-level debug)")
+	recommendCmd.Flags().StringVarP(&timeWindow, "timewindow", "t", "30m", "Time window for Prometheus queries, e.g. 30m, 1d or 7d (default is '30m')")
+	recommendCmd.Flags().Float64Var(&requestPercentile, "request-percentile", 0.5, "Usage percentile to recommend as resource requests (default is the median)")
+	recommendCmd.Flags().Float64Var(&limitPercentile, "limit-percentile", 0.99, "Usage percentile to recommend as resource limits (default is 99th percentile)")
+	recommendCmd.Flags().Float64Var(&cpuPercentile, "cpu-percentile", 0, "Percentile to use for CPU resource limits (default is --limit-percentile)")
+	recommendCmd.Flags().Float64Var(&memoryPercentile, "memory-percentile", 0, "Percentile to use for memory resource limits (default is --limit-percentile)")
 	recommendCmd.Flags().BoolVar(&recommendQuotas, "recommend-quotas", false, "Recommend resource quotas for the namespace")
 	recommendCmd.Flags().BoolVar(&recommendLimitRanges, "recommend-limit-ranges", false, "Recommend limit ranges for the namespace")
+	recommendCmd.Flags().StringVarP(&pod, "pod", "p", "", "Only recommend for the containers of this pod")
+	recommendCmd.Flags().StringVar(&resource, "resource", "both", "Resource to recommend for: cpu, memory or both")
+	recommendCmd.Flags().Float64Var(&headroom, "headroom", 0, "Safety buffer added to the usage percentiles, as a fraction, e.g. 0.2 to recommend 20% more")
+	recommendCmd.Flags().StringVar(&cpuRound, "cpu-round", "10m", "Increment CPU recommendations are rounded up to, e.g. 50m or 100m")
+	recommendCmd.Flags().StringVar(&memoryRound, "mem-round", "1Mi", "Increment memory recommendations are rounded up to, e.g. 64Mi")
+	recommendCmd.Flags().StringVar(&history, "history", "", "Compute the percentiles client-side over all the samples of this window, e.g. 14d, instead of with quantile_over_time over --timewindow")
+	recommendCmd.Flags().DurationVar(&historyStep, "history-step", 5*time.Minute, "Resolution of the samples fetched with --history")
+	recommendCmd.MarkFlagsMutuallyExclusive("history", "timewindow")
+	addFailOverRatioFlag(recommendCmd)
+	addConcurrencyFlag(recommendCmd)
 }
@@ -0,0 +1,324 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplyHeadroom(t *testing.T) {
+	tests := []struct {
+		name           string
+		base, headroom float64
+		want           float64
+	}{
+		{name: "no headroom", base: 0.5, headroom: 0, want: 0.5},
+		{name: "20% headroom", base: 0.5, headroom: 0.2, want: 0.6},
+		{name: "doubled", base: 256, headroom: 1, want: 512},
+		{name: "zero usage", base: 0, headroom: 0.2, want: 0},
+		{name: "negative usage is clamped", base: -0.1, headroom: 0.2, want: 0},
+		{name: "NaN usage is clamped", base: math.NaN(), headroom: 0.2, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyHeadroom(tt.base, tt.headroom); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("applyHeadroom(%g, %g) = %g, want %g", tt.base, tt.headroom, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecommendRejectsNegativeHeadroom(t *testing.T) {
+	savedHeadroom, savedCPU, savedMemory := headroom, cpuPercentile, memoryPercentile
+	t.Cleanup(func() { headroom, cpuPercentile, memoryPercentile = savedHeadroom, savedCPU, savedMemory })
+	headroom = -0.1
+
+	err := recommendCmd.PreRunE(recommendCmd, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid headroom -0.1") {
+		t.Errorf("error = %v, want negative headroom rejected", err)
+	}
+}
+
+func TestRoundUpQuantity(t *testing.T) {
+	tests := []struct {
+		value, increment, want string
+	}{
+		{value: "100m", increment: "50m", want: "100m"},
+		{value: "101m", increment: "50m", want: "150m"},
+		{value: "1", increment: "100m", want: "1"},
+		{value: "1001m", increment: "100m", want: "1100m"},
+		{value: "1m", increment: "10m", want: "10m"},
+		{value: "0", increment: "10m", want: "0"},
+		{value: "64Mi", increment: "64Mi", want: "64Mi"},
+		{value: "65Mi", increment: "64Mi", want: "128Mi"},
+		{value: "1Gi", increment: "1Mi", want: "1Gi"},
+	}
+	for _, tt := range tests {
+		got := roundUpQuantity(k8sresource.MustParse(tt.value), k8sresource.MustParse(tt.increment))
+		if want := k8sresource.MustParse(tt.want); got.Cmp(want) != 0 {
+			t.Errorf("roundUpQuantity(%s, %s) = %s, want %s", tt.value, tt.increment, got.String(), tt.want)
+		}
+	}
+}
+
+func TestResourceQuantities(t *testing.T) {
+	tests := []struct {
+		name      string
+		got       func(increment k8sresource.Quantity) k8sresource.Quantity
+		increment string
+		want      string
+	}{
+		// Floating point noise such as 0.25*1000 = 250.00000000000003 must not round up a step
+		{name: "exact multiple of 10m", got: cpuAt(0.25), increment: "10m", want: "250m"},
+		{name: "just above a 10m step", got: cpuAt(0.2501), increment: "10m", want: "260m"},
+		{name: "whole cores", got: cpuAt(2), increment: "10m", want: "2"},
+		{name: "sub-millicore usage", got: cpuAt(0.0004), increment: "10m", want: "10m"},
+		{name: "just above a 50m step", got: cpuAt(0.101), increment: "50m", want: "150m"},
+		// Recommendations are at least one increment
+		{name: "no CPU usage", got: cpuAt(0), increment: "10m", want: "10m"},
+		{name: "exact multiple of 1Mi", got: memoryAt(64 * mebibyte), increment: "1Mi", want: "64Mi"},
+		{name: "just above a 1Mi step", got: memoryAt(64*mebibyte + 1), increment: "1Mi", want: "65Mi"},
+		{name: "less than a byte", got: memoryAt(0.5), increment: "1Mi", want: "1Mi"},
+		{name: "just above a 64Mi step", got: memoryAt(65 * mebibyte), increment: "64Mi", want: "128Mi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.got(k8sresource.MustParse(tt.increment)); got.String() != tt.want {
+				t.Errorf("got %s rounded up to %s, want %s", got.String(), tt.increment, tt.want)
+			}
+		})
+	}
+}
+
+// cpuAt returns cpuQuantity of cores for a rounding increment
+func cpuAt(cores float64) func(k8sresource.Quantity) k8sresource.Quantity {
+	return func(increment k8sresource.Quantity) k8sresource.Quantity { return cpuQuantity(cores, increment) }
+}
+
+// memoryAt returns memoryQuantity of bytes for a rounding increment
+func memoryAt(bytes float64) func(k8sresource.Quantity) k8sresource.Quantity {
+	return func(increment k8sresource.Quantity) k8sresource.Quantity { return memoryQuantity(bytes, increment) }
+}
+
+func TestRenderResourceYAML(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources corev1.ResourceRequirements
+		want      string
+	}{
+		{
+			name: "requests and limits",
+			resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    k8sresource.MustParse("500m"),
+					corev1.ResourceMemory: k8sresource.MustParse("128Mi"),
+				},
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    k8sresource.MustParse("250m"),
+					corev1.ResourceMemory: k8sresource.MustParse("64Mi"),
+				},
+			},
+			want: `resources:
+  limits:
+    cpu: 500m
+    memory: 128Mi
+  requests:
+    cpu: 250m
+    memory: 64Mi
+`,
+		},
+		{
+			name: "cpu only",
+			resources: corev1.ResourceRequirements{
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: k8sresource.MustParse("2")},
+				Requests: corev1.ResourceList{corev1.ResourceCPU: k8sresource.MustParse("1500m")},
+			},
+			want: `resources:
+  limits:
+    cpu: "2"
+  requests:
+    cpu: 1500m
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderResourceYAML(tt.resources)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("renderResourceYAML() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRoundIncrement(t *testing.T) {
+	for _, value := range []string{"0", "-10m", "ten"} {
+		if _, err := parseRoundIncrement("cpu-round", value); err == nil || !strings.HasPrefix(err.Error(), `invalid --cpu-round "`+value+`"`) {
+			t.Errorf("parseRoundIncrement(%q) error = %v, want an invalid --cpu-round error", value, err)
+		}
+	}
+	if got, err := parseRoundIncrement("mem-round", "64Mi"); err != nil || got.String() != "64Mi" {
+		t.Errorf("parseRoundIncrement(64Mi) = %s, %v, want 64Mi", got.String(), err)
+	}
+}
+
+// usageStub answers every batched usage query with fixed percentiles by query key, and records the queries
+func usageStub(t *testing.T) func() []string {
+	t.Helper()
+	values := map[string]string{
+		"cpu_request":    "0.1",
+		"cpu_limit":      "0.3",
+		"memory_request": fmt.Sprint(100 * mebibyte),
+		"memory_limit":   fmt.Sprint(200 * mebibyte),
+	}
+	var mu sync.Mutex
+	var queries []string
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.FormValue("query")
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+
+		var result []string
+		for key, value := range values {
+			if strings.Contains(query, `"`+key+`"`) {
+				result = append(result, fmt.Sprintf(`{"metric":{%q:%q},"value":[1700000000,%q]}`, batchQueryLabel, key, value))
+			}
+		}
+		respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[`+strings.Join(result, ",")+`]}}`)(w, r)
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+// testContainer returns a container requesting cpu and memory
+func testContainer(name, cpu, memory string) corev1.Container {
+	return corev1.Container{
+		Name: name,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    k8sresource.MustParse(cpu),
+				corev1.ResourceMemory: k8sresource.MustParse(memory),
+			},
+		},
+	}
+}
+
+func TestRecommendNamespace(t *testing.T) {
+	savedStaleness := maxStaleness
+	t.Cleanup(func() { maxStaleness = savedStaleness })
+	maxStaleness = 0
+	usageQueries := usageStub(t)
+
+	clientset := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{testContainer("migrate", "100m", "64Mi")},
+			Containers:     []corev1.Container{testContainer("app", "1", "256Mi")},
+		}}},
+	})
+	opts := recommendOptions{
+		resource:          "both",
+		timeWindow:        "1d",
+		requestPercentile: 0.5,
+		cpuPercentile:     0.9,
+		memoryPercentile:  0.99,
+		headroom:          0.5,
+		cpuRound:          k8sresource.MustParse("50m"),
+		memoryRound:       k8sresource.MustParse("64Mi"),
+		failOverRatio:     0.5,
+		quotas:            true,
+	}
+
+	result, err := recommendNamespace(context.Background(), "shop", clientset, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Workloads) != 1 || result.Workloads[0].Kind != "Deployment" || len(result.Workloads[0].Containers) != 2 {
+		t.Fatalf("workloads = %+v, want the Deployment with its initContainer and container", result.Workloads)
+	}
+	// 0.1 and 0.3 cores and 100Mi and 200Mi plus 50% headroom, rounded up to 50m and 64Mi
+	want := resourceRequirements{
+		Limits:   resourceValues{CPU: "450m", Memory: "320Mi"},
+		Requests: resourceValues{CPU: "150m", Memory: "192Mi"},
+	}
+	for _, container := range result.Workloads[0].Containers {
+		if container.Recommended != want {
+			t.Errorf("container %s recommended %+v, want %+v", container.Name, container.Recommended, want)
+		}
+	}
+	// Using 0.1 cores is below half of the 1 core requested by app, but not of the 100m requested by migrate
+	if init, app := result.Workloads[0].Containers[0], result.Workloads[0].Containers[1]; init.OverProvisioned || !app.OverProvisioned {
+		t.Errorf("over-provisioned = %t for %s and %t for %s, want only app", init.OverProvisioned, init.Name, app.OverProvisioned, app.Name)
+	}
+	if result.ResourceQuota == nil || result.LimitRange != nil {
+		t.Errorf("quota = %v and limit range = %v, want only a quota", result.ResourceQuota, result.LimitRange)
+	}
+
+	queries := strings.Join(usageQueries(), "\n")
+	for _, want := range []string{"quantile_over_time(0.9,", "quantile_over_time(0.99,", "[1d]", `container="app"`} {
+		if !strings.Contains(queries, want) {
+			t.Errorf("queries do not contain %s:\n%s", want, queries)
+		}
+	}
+}
+
+func TestRecommendNamespaceForPod(t *testing.T) {
+	savedStaleness := maxStaleness
+	t.Cleanup(func() { maxStaleness = savedStaleness })
+	maxStaleness = 0
+	usageQueries := usageStub(t)
+
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{testContainer("app", "1", "256Mi")}},
+	})
+	opts := recommendOptions{
+		resource:          "cpu",
+		pod:               "web-1",
+		timeWindow:        "30m",
+		requestPercentile: 0.5,
+		cpuPercentile:     0.99,
+		memoryPercentile:  0.99,
+		cpuRound:          k8sresource.MustParse("10m"),
+		memoryRound:       k8sresource.MustParse("1Mi"),
+	}
+
+	result, err := recommendNamespace(context.Background(), "shop", clientset, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Workloads) != 1 || result.Workloads[0].Kind != "Pod" || result.Workloads[0].Name != "web-1" {
+		t.Fatalf("workloads = %+v, want pod web-1", result.Workloads)
+	}
+	// Memory was not requested, so only CPU is recommended and queried
+	container := result.Workloads[0].Containers[0]
+	if want := (resourceRequirements{Limits: resourceValues{CPU: "300m"}, Requests: resourceValues{CPU: "100m"}}); container.Recommended != want {
+		t.Errorf("recommended %+v, want %+v", container.Recommended, want)
+	}
+	for _, query := range usageQueries() {
+		if !strings.Contains(query, `pod="web-1"`) || strings.Contains(query, "memory") {
+			t.Errorf("query %s is not narrowed to the CPU usage of pod web-1", query)
+		}
+	}
+
+	if _, err := recommendNamespace(context.Background(), "other", clientset, opts); err == nil || !strings.Contains(err.Error(), "getting pod other/web-1") {
+		t.Errorf("error = %v, want the missing pod reported", err)
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// missingRequests selects the analyze mode listing the containers without CPU requests
+var missingRequests bool
+
+// containerIdentity identifies a container of a pod
+type containerIdentity struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+}
+
+// queryMissingCPURequests returns the containers of running pods in the namespace that have no CPU request
+func queryMissingCPURequests(ctx context.Context, namespace string) ([]containerIdentity, error) {
+	containers, err := queryPrometheusVector(ctx, runningContainersQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying running containers of %s: %w", describeNamespace(namespace), err)
+	}
+	requests, err := queryPrometheusVector(ctx, containerCPURequestsQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying container CPU requests of %s: %w", describeNamespace(namespace), err)
+	}
+	return missingContainers(containers, requests), nil
+}
+
+// missingContainers returns the containers of the first vector that are not in the second one, ordered by
+// namespace, pod and container. Containers are compared individually, so a pod where only some containers
+// have requests reports the others.
+func missingContainers(containers, requests []prometheusVectorSample) []containerIdentity {
+	present := map[containerIdentity]bool{}
+	for _, sample := range requests {
+		present[sampleContainer(sample)] = true
+	}
+
+	seen := map[containerIdentity]bool{}
+	missing := []containerIdentity{}
+	for _, sample := range containers {
+		container := sampleContainer(sample)
+		if present[container] || seen[container] {
+			continue
+		}
+		seen[container] = true
+		missing = append(missing, container)
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		if missing[i].Namespace != missing[j].Namespace {
+			return missing[i].Namespace < missing[j].Namespace
+		}
+		if missing[i].Pod != missing[j].Pod {
+			return missing[i].Pod < missing[j].Pod
+		}
+		return missing[i].Container < missing[j].Container
+	})
+	return missing
+}
+
+// sampleContainer returns the container a sample of a per-container metric is about
+func sampleContainer(sample prometheusVectorSample) containerIdentity {
+	return containerIdentity{
+		Namespace: sample.Metric["namespace"],
+		Pod:       sample.Metric["pod"],
+		Container: sample.Metric["container"],
+	}
+}
+
+// runMissingRequests lists the containers without CPU requests in the namespaces
+func runMissingRequests(ctx context.Context, namespaces []string) error {
+	results, namespaceErr := runPerNamespace(namespaces, func(namespace string) ([]containerIdentity, error) {
+		return queryMissingCPURequests(ctx, namespace)
+	})
+	if len(results) == 0 && namespaceErr != nil {
+		return namespaceErr
+	}
+
+	containers := []containerIdentity{}
+	for _, result := range results {
+		containers = append(containers, result...)
+	}
+	if outputFormat == "json" {
+		if err := printJSON(containers); err != nil {
+			return err
+		}
+	} else {
+		printMissingRequests(namespaces, containers)
+	}
+	return namespaceErr
+}
+
+// printMissingRequests prints the containers without CPU requests in text or table format
+func printMissingRequests(namespaces []string, containers []containerIdentity) {
+	if len(containers) == 0 {
+		for _, namespace := range namespaces {
+			fmt.Printf("All running containers in %s have CPU requests\n", describeNamespace(namespace))
+		}
+		return
+	}
+
+	if outputFormat == "table" {
+		rows := make([][]string, 0, len(containers))
+		for _, container := range containers {
+			rows = append(rows, []string{container.Namespace, container.Pod, container.Container})
+		}
+		fmt.Print(renderTable([]string{"NAMESPACE", "POD", "CONTAINER"}, rows))
+		return
+	}
+
+	fmt.Println("Containers without CPU requests:")
+	for _, container := range containers {
+		fmt.Printf("  %s/%s, container %s\n", container.Namespace, container.Pod, container.Container)
+	}
+}
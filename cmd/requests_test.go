@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+// containerSample returns a sample of a per-container metric
+func containerSample(namespace, pod, container string) prometheusVectorSample {
+	return prometheusVectorSample{Metric: map[string]string{"namespace": namespace, "pod": pod, "container": container}, Value: 1}
+}
+
+func TestMissingContainers(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []prometheusVectorSample
+		requests   []prometheusVectorSample
+		want       []containerIdentity
+	}{
+		{
+			name:       "all containers have requests",
+			containers: []prometheusVectorSample{containerSample("a", "web-1", "app")},
+			requests:   []prometheusVectorSample{containerSample("a", "web-1", "app")},
+			want:       []containerIdentity{},
+		},
+		{
+			name: "only one container of a pod is missing requests",
+			containers: []prometheusVectorSample{
+				containerSample("a", "web-1", "app"),
+				containerSample("a", "web-1", "sidecar"),
+			},
+			requests: []prometheusVectorSample{containerSample("a", "web-1", "app")},
+			want:     []containerIdentity{{Namespace: "a", Pod: "web-1", Container: "sidecar"}},
+		},
+		{
+			name: "same container name in another pod or namespace",
+			containers: []prometheusVectorSample{
+				containerSample("b", "web-1", "app"),
+				containerSample("a", "web-2", "app"),
+				containerSample("a", "web-1", "app"),
+			},
+			requests: []prometheusVectorSample{containerSample("a", "web-1", "app")},
+			want: []containerIdentity{
+				{Namespace: "a", Pod: "web-2", Container: "app"},
+				{Namespace: "b", Pod: "web-1", Container: "app"},
+			},
+		},
+		{
+			name: "duplicate series are reported once",
+			containers: []prometheusVectorSample{
+				containerSample("a", "web-1", "app"),
+				containerSample("a", "web-1", "app"),
+			},
+			want: []containerIdentity{{Namespace: "a", Pod: "web-1", Container: "app"}},
+		},
+		{
+			name: "no running containers",
+			want: []containerIdentity{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingContainers(tt.containers, tt.requests); !slices.Equal(got, tt.want) {
+				t.Errorf("missingContainers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
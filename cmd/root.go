@@ -5,12 +5,33 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+// defaultQueryTimeout is used when neither the flag nor the config file set a query timeout
+const defaultQueryTimeout = 10 * time.Second
 
+// defaultPrometheusURL is used when neither the flag, the environment nor the config file set a Prometheus URL
+const defaultPrometheusURL = "http://localhost:9090"
+
+var (
+	cfgFile       string
+	prometheusURL string        // Base URL of the Prometheus server
+	queryTimeout  time.Duration // Timeout applied to each Prometheus query
+	maxRetries    int           // Number of times a transient Prometheus failure is retried
+	outputFormat  string        // Output format for command results: text, table or json
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -25,27 +46,234 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	// Errors from a command's execution are not usage errors
+	SilenceUsage: true,
+	// Errors are printed by Execute, which reports an interrupt once instead of every query it canceled
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := configureLogging(); err != nil {
+			return err
+		}
+		// initConfig runs before logging is configured, so a missing config file is reported here
+		if viper.ConfigFileUsed() == "" {
+			logger.Debug("No config file found, using flags and environment variables only", "searched", configSearchPaths())
+		}
+		// The flag takes precedence over the environment, then the config file, then the default
+		prometheusEndpoints = prometheusURLsFromConfig()
+		if len(prometheusEndpoints) == 0 {
+			return fmt.Errorf("no Prometheus URL configured: set --prometheus-url, PROMETHEUS_URL or prometheus.url in the config file")
+		}
+		queryTimeout = viper.GetDuration("prometheus.timeout")
+		if queryTimeout <= 0 {
+			return fmt.Errorf("invalid query timeout %q: must be greater than zero", viper.GetString("prometheus.timeout"))
+		}
+		maxRetries = viper.GetInt("prometheus.max_retries")
+		if maxRetries < 0 {
+			return fmt.Errorf("invalid max retries %d: must not be negative", maxRetries)
+		}
+		cacheTTL = viper.GetDuration("prometheus.cache_ttl")
+		if cacheTTL < 0 {
+			return fmt.Errorf("invalid cache TTL %s: must not be negative", cacheTTL)
+		}
+		labels, _ := cmd.Flags().GetStringArray("label")
+		var err error
+		if extraMatchers, err = parseLabelMatchers(labels); err != nil {
+			return err
+		}
+		if err := validateKubeContext(); err != nil {
+			return err
+		}
+		if err := loadQueryTemplates(); err != nil {
+			return err
+		}
+		if err := startEvaluationOffset(); err != nil {
+			return err
+		}
+		if err := startDryRun(); err != nil {
+			return err
+		}
+		if err := startOutputFile(); err != nil {
+			return err
+		}
+		if err := startColor(); err != nil {
+			return err
+		}
+		if err := configurePrometheusClient(); err != nil {
+			return err
+		}
+		if precision < -1 {
+			return fmt.Errorf("invalid precision %d: must be -1 or more", precision)
+		}
+		if outputFormat == "" {
+			outputFormat = defaultOutputFormat()
+		}
+		return validateOutput(cmd, outputFormat)
+	},
+}
+
+// exitCodeInterrupted is the exit status after SIGINT or SIGTERM, following the shell convention of 128 + SIGINT
+const exitCodeInterrupted = 130
+
+// configDirName is the directory holding config.yaml under $XDG_CONFIG_HOME and /etc
+const configDirName = "k8s-capacity"
+
+// exitError is returned by commands that need to exit with a specific status
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	// Cancel in-flight queries on Ctrl-C instead of waiting for them to time out
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	interrupted := ctx.Err() != nil
+	stop()
+
+	// Commands exiting with a specific status, e.g. for over-provisioning, still rendered their report
+	var exitErr *exitError
+	if fileErr := finishOutputFile(!interrupted && (err == nil || errors.As(err, &exitErr))); fileErr != nil && err == nil {
+		err = fileErr
+	}
+
+	if showQueryStats {
+		printQueryStats(os.Stderr)
+	}
+	if err == nil && strictWarningSeen.Load() {
+		err = errors.New("prometheus returned warnings and --strict is set")
+	}
+	if interrupted {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		os.Exit(exitCodeInterrupted)
+	}
 	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
 
 func init() {
+	cobra.OnInitialize(initConfig)
+	viper.SetDefault("prometheus.scrape_interval", 30*time.Second)
+	viper.SetDefault("prometheus.url", defaultPrometheusURL)
+
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.k.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is the first of $HOME/.k.yaml, $XDG_CONFIG_HOME/k8s-capacity/config.yaml, /etc/k8s-capacity/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Profile of the config file whose settings override the top-level ones, e.g. to switch between clusters")
+	rootCmd.PersistentFlags().String("prometheus-url", "", "Prometheus base URL, or comma-separated URLs of replicas tried in order when one is unreachable (overrides PROMETHEUS_URL and prometheus.url from the config file)")
+	viper.BindPFlag("prometheus.url", rootCmd.PersistentFlags().Lookup("prometheus-url"))
+	rootCmd.PersistentFlags().String("tenant", "", "Tenant sent in the X-Scope-OrgID header to multi-tenant Cortex, Mimir or Thanos (overrides prometheus.tenant from the config file)")
+	viper.BindPFlag("prometheus.tenant", rootCmd.PersistentFlags().Lookup("tenant"))
+	rootCmd.PersistentFlags().String("proxy-url", "", "HTTP proxy for Prometheus requests (overrides prometheus.proxy_url from the config file, default is HTTP_PROXY and HTTPS_PROXY)")
+	viper.BindPFlag("prometheus.proxy_url", rootCmd.PersistentFlags().Lookup("proxy-url"))
+	rootCmd.PersistentFlags().StringVar(&kubeContext, "context", "", "Kubeconfig context to read the default namespace from (default is the current context)")
+	rootCmd.PersistentFlags().BoolVar(&strictWarnings, "strict", false, "Fail queries for which Prometheus returns warnings, e.g. about truncated or partial results, instead of printing them")
+	rootCmd.PersistentFlags().DurationVar(&maxStaleness, "max-staleness", 5*time.Minute, "Warn when the newest usage sample is older than this, e.g. because an exporter died; 0 disables the check")
+	rootCmd.PersistentFlags().BoolVar(&assumeYes, "yes", false, "Run expensive range queries without asking for confirmation")
+	rootCmd.PersistentFlags().StringVar(&outputFile, "output-file", "", "Write the report to this file, replacing it once the command succeeded, instead of to stdout")
+	rootCmd.PersistentFlags().BoolVar(&appendOutput, "append", false, "Append the report to --output-file instead of replacing it")
+	rootCmd.PersistentFlags().DurationVar(&evaluationOffset, "eval-offset", 0, "Evaluate queries this long before now, e.g. 1m to skip an incomplete latest scrape; unlike query --at it shifts every query of the command")
+	rootCmd.PersistentFlags().IntVar(&precision, "precision", -1, "Number of decimals of the values in text, table and csv output; -1 keeps 2 for cores, 1 for memory and percentages and 3 for cores in csv")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the PromQL queries the command would run instead of its report, without contacting Prometheus")
+	rootCmd.PersistentFlags().BoolVar(&showQueryStats, "metrics", false, "Print the number and the min, max and average duration of the Prometheus queries to stderr at the end of the run")
+	rootCmd.PersistentFlags().StringArray("label", nil, "Label matcher key=value added to every generated query, e.g. cluster=prod in a federated setup; can be repeated")
+	rootCmd.PersistentFlags().Duration("query-timeout", defaultQueryTimeout, "Timeout for each Prometheus query (overrides prometheus.timeout from the config file)")
+	viper.BindPFlag("prometheus.timeout", rootCmd.PersistentFlags().Lookup("query-timeout"))
+	rootCmd.PersistentFlags().Int("max-retries", 3, "Number of retries for transient Prometheus errors (overrides prometheus.max_retries from the config file)")
+	viper.BindPFlag("prometheus.max_retries", rootCmd.PersistentFlags().Lookup("max-retries"))
+	rootCmd.PersistentFlags().Duration("cache-ttl", 0, "How long to reuse Prometheus responses for identical queries, 0 disables caching (overrides prometheus.cache_ttl from the config file)")
+	viper.BindPFlag("prometheus.cache_ttl", rootCmd.PersistentFlags().Lookup("cache-ttl"))
+	rootCmd.PersistentFlags().String("log-level", "info", "Level of diagnostic messages on stderr: debug, info, warn or error (overrides log.level from the config file)")
+	viper.BindPFlag("log.level", rootCmd.PersistentFlags().Lookup("log-level"))
+	rootCmd.PersistentFlags().String("log-format", "", "Format of diagnostic messages on stderr: text or json (default is text for terminals, json otherwise; overrides log.format from the config file)")
+	viper.BindPFlag("log.format", rootCmd.PersistentFlags().Lookup("log-format"))
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only print warnings and errors on stderr, e.g. to get clean output with --output json (raises --log-level to at least warn)")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log debug messages, including every PromQL query run (same as --log-level debug)")
+	rootCmd.PersistentFlags().StringVar(&colorMode, "color", "auto", "Color values beyond their thresholds in red and healthy ones in green in table output: auto (when stdout is a terminal and NO_COLOR is unset), always or never")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "", "Output format: text, table, json, yaml (recommend only) prometheus or csv (analyze only) (default is table for terminals, text otherwise)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
+// initConfig reads in config file if set.
+func initConfig() {
+	// Map nested keys to environment variables, e.g. prometheus.url to PROMETHEUS_URL
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	configFile, err := readConfigFile(viper.GetViper(), cfgFile)
+	cobra.CheckErr(err)
+	if configFile != "" {
+		if !quiet {
+			fmt.Fprintln(os.Stderr, "Using config file:", configFile)
+		}
+		cobra.CheckErr(validateConfig(viper.GetViper(), os.Stderr))
+	}
+	cobra.CheckErr(applyProfile(viper.GetViper()))
+}
+
+// readConfigFile reads the config file from the flag, or the first one found in the standard locations, into v and
+// returns its path. Running without one is fine since everything can be set with flags and environment variables, so
+// "" is returned when none is found. A config file that can't be read or parsed is an error rather than ignored.
+func readConfigFile(v *viper.Viper, flagValue string) (string, error) {
+	configFile := flagValue
+	if configFile == "" {
+		configFile = findConfigFile()
+	}
+	if configFile == "" {
+		return "", nil
+	}
+	v.SetConfigFile(configFile)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return "", fmt.Errorf("reading config file %s: %w", configFile, err)
+	}
+	return configFile, nil
+}
+
+// configSearchPaths returns the config file locations in order of precedence: $HOME/.k.yaml,
+// $XDG_CONFIG_HOME/k8s-capacity/config.yaml, where XDG_CONFIG_HOME defaults to $HOME/.config,
+// and /etc/k8s-capacity/config.yaml
+func configSearchPaths() []string {
+	var paths []string
+	home, err := os.UserHomeDir()
+	if err == nil {
+		paths = append(paths, filepath.Join(home, ".k.yaml"))
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" && home != "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, configDirName, "config.yaml"))
+	}
+	return append(paths, filepath.Join("/etc", configDirName, "config.yaml"))
+}
 
+// findConfigFile returns the first config file that exists in the search paths, or "" if there is none
+func findConfigFile() string {
+	for _, path := range configSearchPaths() {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	// Keep the search paths in an empty directory, /etc excepted
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	if findConfigFile() != "" {
+		t.Skip("a config file exists in /etc, the search can't be tested")
+	}
+
+	writeConfig := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(home, ".k.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Remove(path) })
+		return path
+	}
+
+	t.Run("missing file is ignored", func(t *testing.T) {
+		used, err := readConfigFile(viper.New(), "")
+		if err != nil || used != "" {
+			t.Errorf("readConfigFile() = %q, %v, want no file and no error", used, err)
+		}
+	})
+
+	t.Run("file from the search paths is read", func(t *testing.T) {
+		path := writeConfig(t, "prometheus:\n  url: http://prometheus:9090\n")
+		v := viper.New()
+		used, err := readConfigFile(v, "")
+		if err != nil || used != path {
+			t.Fatalf("readConfigFile() = %q, %v, want %q", used, err, path)
+		}
+		if got := v.GetString("prometheus.url"); got != "http://prometheus:9090" {
+			t.Errorf("prometheus.url = %q, want http://prometheus:9090", got)
+		}
+	})
+
+	t.Run("broken file is an error", func(t *testing.T) {
+		path := writeConfig(t, "prometheus:\n  url: [http://prometheus:9090\n")
+		_, err := readConfigFile(viper.New(), "")
+		if err == nil || !strings.HasPrefix(err.Error(), "reading config file "+path) {
+			t.Errorf("error = %v, want an error reading %s", err, path)
+		}
+	})
+
+	t.Run("missing file given with --config is an error", func(t *testing.T) {
+		path := filepath.Join(home, "missing.yaml")
+		_, err := readConfigFile(viper.New(), path)
+		if err == nil || !strings.HasPrefix(err.Error(), "reading config file "+path) {
+			t.Errorf("error = %v, want an error reading %s", err, path)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	sortKey   string // Key rows are ordered by: name, usage or utilization, empty for the default order; set by --sort
+	sortOrder string // asc or desc, empty for ascending names and descending numbers; set by --sort-order
+)
+
+// addSortFlags registers the --sort and --sort-order flags on a command accepting the given sort keys
+func addSortFlags(cmd *cobra.Command, keys ...string) {
+	cmd.Flags().StringVar(&sortKey, "sort", "", fmt.Sprintf("Order rows by %s (default is the command's own order)", strings.Join(keys, ", ")))
+	cmd.Flags().StringVar(&sortOrder, "sort-order", "", "Order of --sort: asc or desc (default is asc for name and desc otherwise)")
+}
+
+// validateSort checks --sort against the keys a command accepts, and --sort-order
+func validateSort(keys ...string) error {
+	if sortKey != "" && !slices.Contains(keys, sortKey) {
+		return fmt.Errorf("invalid sort key %q: must be one of %s", sortKey, strings.Join(keys, ", "))
+	}
+	switch sortOrder {
+	case "", "asc", "desc":
+	default:
+		return fmt.Errorf("invalid sort order %q: must be asc or desc", sortOrder)
+	}
+	if sortOrder != "" && sortKey == "" {
+		return fmt.Errorf("--sort-order requires --sort")
+	}
+	return nil
+}
+
+// sortRows orders rows by --sort, keeping the order of equal rows. usage and utilization return nil for rows without a
+// value, which always come last; a nil utilization function falls back to usage for rows that have no utilization.
+func sortRows[T any](rows []T, name func(T) string, usage, utilization func(T) *float64) {
+	if sortKey == "" {
+		return
+	}
+	if utilization == nil {
+		utilization = usage
+	}
+	descending := sortOrder == "desc" || sortOrder == "" && sortKey != "name"
+
+	slices.SortStableFunc(rows, func(a, b T) int {
+		var c int
+		switch sortKey {
+		case "name":
+			c = strings.Compare(name(a), name(b))
+		case "usage", "utilization":
+			value := usage
+			if sortKey == "utilization" {
+				value = utilization
+			}
+			va, vb := value(a), value(b)
+			switch {
+			case va == nil && vb == nil:
+				return 0
+			case va == nil:
+				return 1
+			case vb == nil:
+				return -1
+			}
+			c = cmp.Compare(*va, *vb)
+		}
+		if descending {
+			c = -c
+		}
+		return c
+	})
+}
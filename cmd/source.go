@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// sourceName is the backend usage is read from, set by --source
+var sourceName string
+
+// usageSource is the backend selected with --source, set when the command runs
+var usageSource metricsSource = prometheusSource{}
+
+// metricsSource reads the current usage and requests of namespaces, the whole cluster for an empty namespace
+type metricsSource interface {
+	// cpuUsageForNamespace returns the CPU usage in cores, or errNoData when no containers are running
+	cpuUsageForNamespace(ctx context.Context, namespace string) (float64, error)
+	// memoryUsageForNamespace returns the memory working set in bytes, or errNoData when no containers are running
+	memoryUsageForNamespace(ctx context.Context, namespace string) (float64, error)
+	// cpuRequestsForNamespace returns the CPU requested by running containers in cores, 0 when none is requested
+	cpuRequestsForNamespace(ctx context.Context, namespace string) (float64, error)
+}
+
+// prometheusSource reads usage from cAdvisor metrics and requests from kube-state-metrics
+type prometheusSource struct{}
+
+func (prometheusSource) cpuUsageForNamespace(ctx context.Context, namespace string) (float64, error) {
+	return queryPrometheusValue(ctx, namespaceCPUUsageQuery(namespace))
+}
+
+func (prometheusSource) memoryUsageForNamespace(ctx context.Context, namespace string) (float64, error) {
+	return queryPrometheusValue(ctx, namespaceMemoryUsageQuery(namespace))
+}
+
+func (prometheusSource) cpuRequestsForNamespace(ctx context.Context, namespace string) (float64, error) {
+	requests, err := queryPrometheusValue(ctx, namespaceCPURequestsQuery(namespace))
+	if errors.Is(err, errNoData) {
+		return 0, nil
+	}
+	return requests, err
+}
+
+// metricsServerSource reads usage from the metrics.k8s.io API served by metrics-server and requests from pod specs
+type metricsServerSource struct {
+	clientset *kubernetes.Clientset
+}
+
+// podMetricsList is the subset of a metrics.k8s.io/v1beta1 PodMetricsList that is used
+type podMetricsList struct {
+	Items []struct {
+		Containers []struct {
+			Name  string              `json:"name"`
+			Usage corev1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+func (s metricsServerSource) cpuUsageForNamespace(ctx context.Context, namespace string) (float64, error) {
+	return s.sumUsage(ctx, namespace, corev1.ResourceCPU)
+}
+
+func (s metricsServerSource) memoryUsageForNamespace(ctx context.Context, namespace string) (float64, error) {
+	return s.sumUsage(ctx, namespace, corev1.ResourceMemory)
+}
+
+// sumUsage adds up the usage of a resource over the containers of a namespace
+func (s metricsServerSource) sumUsage(ctx context.Context, namespace string, name corev1.ResourceName) (float64, error) {
+	// The typed metrics client isn't a dependency, the API is small enough to read directly
+	path := "/apis/metrics.k8s.io/v1beta1/pods"
+	if namespace != "" {
+		path = fmt.Sprintf("/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods", namespace)
+	}
+	body, err := s.clientset.CoreV1().RESTClient().Get().AbsPath(path).DoRaw(ctx)
+	if apierrors.IsNotFound(err) {
+		return 0, fmt.Errorf("metrics.k8s.io API not found, is metrics-server installed?")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading pod metrics: %w", err)
+	}
+	var list podMetricsList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return 0, fmt.Errorf("decoding pod metrics: %w", err)
+	}
+
+	var total float64
+	containers := 0
+	for _, pod := range list.Items {
+		for _, container := range pod.Containers {
+			if quantity, ok := container.Usage[name]; ok {
+				total += quantity.AsApproximateFloat64()
+				containers++
+			}
+		}
+	}
+	if containers == 0 {
+		return 0, errNoData
+	}
+	return total, nil
+}
+
+func (s metricsServerSource) cpuRequestsForNamespace(ctx context.Context, namespace string) (float64, error) {
+	pods, err := s.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "status.phase=Running",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("listing pods: %w", err)
+	}
+	var requests float64
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			if request, ok := container.Resources.Requests[corev1.ResourceCPU]; ok {
+				requests += request.AsApproximateFloat64()
+			}
+		}
+	}
+	return requests, nil
+}
+
+// useMetricsServer reports whether usage is read from metrics-server rather than Prometheus
+func useMetricsServer() bool {
+	return sourceName == "metrics-server"
+}
+
+// validateSource checks --source
+func validateSource() error {
+	switch sourceName {
+	case "prometheus", "metrics-server":
+		return nil
+	}
+	return fmt.Errorf("invalid source %q: must be prometheus or metrics-server", sourceName)
+}
+
+// startSource selects the backend named by --source
+func startSource() error {
+	if !useMetricsServer() {
+		usageSource = prometheusSource{}
+		return nil
+	}
+	clientset, err := newKubernetesClient()
+	if err != nil {
+		return err
+	}
+	usageSource = metricsServerSource{clientset: clientset}
+	return nil
+}
+
+func init() {
+	// Only analyze registers --source, the other commands are told why it is rejected rather than just that it is unknown
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		if cmd != analyzeCmd && strings.HasPrefix(err.Error(), "unknown flag: --source") {
+			return fmt.Errorf("--source is only supported by analyze, %s always reads usage from Prometheus", cmd.Name())
+		}
+		return err
+	})
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// mockSource is a metricsSource returning fixed values, recording the namespaces it was asked about
+type mockSource struct {
+	cpuUsage, memoryUsage, cpuRequests float64
+	usageErr, requestsErr              error
+	namespaces                         []string
+}
+
+func (m *mockSource) cpuUsageForNamespace(ctx context.Context, namespace string) (float64, error) {
+	m.namespaces = append(m.namespaces, namespace)
+	return m.cpuUsage, m.usageErr
+}
+
+func (m *mockSource) memoryUsageForNamespace(ctx context.Context, namespace string) (float64, error) {
+	m.namespaces = append(m.namespaces, namespace)
+	return m.memoryUsage, m.usageErr
+}
+
+func (m *mockSource) cpuRequestsForNamespace(ctx context.Context, namespace string) (float64, error) {
+	return m.cpuRequests, m.requestsErr
+}
+
+// useSource makes analyze read CPU usage from source alone for the duration of the test
+func useSource(t *testing.T, source metricsSource) {
+	t.Helper()
+	savedSource, savedName, savedResource, savedRatio := usageSource, sourceName, analyzeResource, failOverRatio
+	t.Cleanup(func() {
+		usageSource, sourceName, analyzeResource, failOverRatio = savedSource, savedName, savedResource, savedRatio
+	})
+	// Outside of Prometheus mode the breakdowns that only Prometheus knows are skipped
+	usageSource, sourceName, analyzeResource, failOverRatio = source, "metrics-server", "cpu", 0
+}
+
+func TestAnalyzeNamespaceWithMockSource(t *testing.T) {
+	t.Run("utilization", func(t *testing.T) {
+		source := &mockSource{cpuUsage: 0.5, cpuRequests: 2}
+		useSource(t, source)
+		failOverRatio = 0.5
+
+		result, err := analyzeNamespace(context.Background(), "a")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(source.namespaces) != 1 || source.namespaces[0] != "a" {
+			t.Errorf("source was asked about %v, want [a]", source.namespaces)
+		}
+		if result.CPU == nil || result.CPU.Usage != 0.5 || result.CPU.Requests != 2 {
+			t.Fatalf("CPU = %+v, want usage 0.5 and requests 2", result.CPU)
+		}
+		if result.CPU.UtilizationPct == nil || *result.CPU.UtilizationPct != 25 {
+			t.Errorf("utilization = %v, want 25%%", result.CPU.UtilizationPct)
+		}
+		if !result.CPU.OverProvisioned {
+			t.Error("25% utilization is below a fail-over ratio of 0.5 but the namespace is not over-provisioned")
+		}
+	})
+
+	t.Run("no running containers", func(t *testing.T) {
+		useSource(t, &mockSource{usageErr: errNoData})
+
+		result, err := analyzeNamespace(context.Background(), "a")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.CPU != nil {
+			t.Errorf("CPU = %+v, want none without usage data", result.CPU)
+		}
+	})
+
+	t.Run("memory working set", func(t *testing.T) {
+		source := &mockSource{memoryUsage: 512 * mebibyte}
+		useSource(t, source)
+		analyzeResource = "memory"
+
+		result, err := analyzeNamespace(context.Background(), "a")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(source.namespaces) != 1 || source.namespaces[0] != "a" {
+			t.Errorf("source was asked about %v, want [a]", source.namespaces)
+		}
+		if result.MemoryWorkingSet == nil || *result.MemoryWorkingSet != 512*mebibyte {
+			t.Errorf("memory working set = %v, want 512Mi", result.MemoryWorkingSet)
+		}
+		if result.CPU != nil || result.Memory != nil {
+			t.Errorf("CPU = %+v and containers = %+v, want only the memory working set", result.CPU, result.Memory)
+		}
+	})
+
+	t.Run("source errors", func(t *testing.T) {
+		failure := errors.New("metrics API unavailable")
+		for _, source := range []*mockSource{{usageErr: failure}, {cpuUsage: 1, requestsErr: failure}} {
+			useSource(t, source)
+			if _, err := analyzeNamespace(context.Background(), "a"); !errors.Is(err, failure) {
+				t.Errorf("error = %v, want the source error", err)
+			}
+		}
+	})
+}
+
+func TestSourceOnlySupportedByAnalyze(t *testing.T) {
+	for _, cmd := range []*cobra.Command{recommendCmd, compareCmd, topCmd, trendCmd} {
+		err := cmd.ParseFlags([]string{"--source", "metrics-server"})
+		if err == nil {
+			t.Fatalf("%s accepted --source", cmd.Name())
+		}
+		err = cmd.FlagErrorFunc()(cmd, err)
+		if want := "--source is only supported by analyze"; !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("%s error = %v, want %q", cmd.Name(), err, want)
+		}
+	}
+}
+
+func TestPrometheusSource(t *testing.T) {
+	useAggregation(t, "sum")
+	var empty bool
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		value := ""
+		switch query := r.FormValue("query"); {
+		case empty:
+		case strings.Contains(query, "container_memory_working_set_bytes"):
+			value = "1073741824"
+		case strings.Contains(query, "container_cpu_usage_seconds_total"):
+			value = "0.5"
+		case strings.Contains(query, "kube_pod_container_resource_requests"):
+			value = "2"
+		}
+		result := ""
+		if value != "" {
+			result = `{"metric":{},"value":[1700000000,"` + value + `"]}`
+		}
+		respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[`+result+`]}}`)(w, r)
+	})
+	ctx := context.Background()
+	var source metricsSource = prometheusSource{}
+
+	if usage, err := source.cpuUsageForNamespace(ctx, "a"); err != nil || usage != 0.5 {
+		t.Errorf("CPU usage = %g, %v, want 0.5", usage, err)
+	}
+	if usage, err := source.memoryUsageForNamespace(ctx, "a"); err != nil || usage != 1<<30 {
+		t.Errorf("memory usage = %g, %v, want 1Gi", usage, err)
+	}
+	if requests, err := source.cpuRequestsForNamespace(ctx, "a"); err != nil || requests != 2 {
+		t.Errorf("CPU requests = %g, %v, want 2", requests, err)
+	}
+
+	// Without running containers there is no usage, and nothing requested
+	empty = true
+	if _, err := source.cpuUsageForNamespace(ctx, "a"); !errors.Is(err, errNoData) {
+		t.Errorf("CPU usage error = %v, want errNoData", err)
+	}
+	if _, err := source.memoryUsageForNamespace(ctx, "a"); !errors.Is(err, errNoData) {
+		t.Errorf("memory usage error = %v, want errNoData", err)
+	}
+	if requests, err := source.cpuRequestsForNamespace(ctx, "a"); err != nil || requests != 0 {
+		t.Errorf("CPU requests = %g, %v, want 0", requests, err)
+	}
+}
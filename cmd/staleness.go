@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// maxStaleness is how old the newest usage sample may be before a warning is printed, 0 disables the check
+var maxStaleness time.Duration
+
+// staleWarningPrinted makes sure a dead exporter is reported once rather than for every namespace or query
+var staleWarningPrinted atomic.Bool
+
+// newestSampleAge returns how long before now the newest sample was taken.
+// The boolean is false when there are no samples.
+func newestSampleAge(samples []prometheusVectorSample, now time.Time) (time.Duration, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+	newest := samples[0].Timestamp
+	for _, sample := range samples[1:] {
+		if sample.Timestamp.After(newest) {
+			newest = sample.Timestamp
+		}
+	}
+	return now.Sub(newest), true
+}
+
+// warnIfStale prints a warning when the newest of samples is older than --max-staleness
+func warnIfStale(what string, samples []prometheusVectorSample, now time.Time) {
+	if maxStaleness <= 0 {
+		return
+	}
+	age, ok := newestSampleAge(samples, now)
+	if !ok || age <= maxStaleness {
+		return
+	}
+	if staleWarningPrinted.CompareAndSwap(false, true) {
+		fmt.Fprintf(os.Stderr, "Warning: the newest %s is %s old, more than --max-staleness %s: results are based on stale data, check that the exporter is running\n",
+			what, formatPrometheusDuration(age.Truncate(time.Second)), formatPrometheusDuration(maxStaleness))
+	}
+}
+
+// stalenessSearchWindow is how far beyond --max-staleness checkUsageStaleness looks for the newest usage sample
+const stalenessSearchWindow = time.Hour
+
+// checkUsageStaleness warns when the newest CPU usage sample of a namespace is older than --max-staleness. Instant
+// query results are stamped with the evaluation time, so the sample times are queried with timestamp(). Callers only
+// check once their usage queries returned data, so that namespaces without any don't cost an extra subquery.
+// Failures only skip the check, the usage queries themselves report them.
+func checkUsageStaleness(ctx context.Context, namespace string) {
+	// Stale data is reported once, so there is nothing left to check for after a warning
+	if maxStaleness <= 0 || dryRun || staleWarningPrinted.Load() {
+		return
+	}
+	window := maxStaleness + stalenessSearchWindow
+	samples, err := queryPrometheusVector(ctx, newestCPUUsageSampleQuery(namespace, window))
+	if err != nil {
+		logger.Debug("Skipping staleness check", "namespace", namespace, "error", err)
+		return
+	}
+	// Turn the sample times returned as values into sample timestamps
+	for i := range samples {
+		samples[i].Timestamp = time.Unix(0, int64(samples[i].Value*float64(time.Second)))
+	}
+	warnIfStale(fmt.Sprintf("CPU usage sample of %s", describeNamespace(namespace)), samples, evaluationNow())
+}
+
+// lastSamples returns the last sample of every series, for checking the staleness of a range query result
+func lastSamples(series []prometheusSeries) []prometheusVectorSample {
+	var samples []prometheusVectorSample
+	for _, s := range series {
+		if len(s.Samples) > 0 {
+			last := s.Samples[len(s.Samples)-1]
+			samples = append(samples, prometheusVectorSample{Metric: s.Metric, Timestamp: last.Timestamp, Value: last.Value})
+		}
+	}
+	return samples
+}
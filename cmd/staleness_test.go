@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewestSampleAge(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sampleAt := func(ago time.Duration) prometheusVectorSample {
+		return prometheusVectorSample{Timestamp: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name    string
+		samples []prometheusVectorSample
+		want    time.Duration
+		wantOK  bool
+	}{
+		{name: "no samples", samples: nil, wantOK: false},
+		{name: "single sample", samples: []prometheusVectorSample{sampleAt(time.Minute)}, want: time.Minute, wantOK: true},
+		{
+			name:    "newest of several samples",
+			samples: []prometheusVectorSample{sampleAt(time.Hour), sampleAt(30 * time.Second), sampleAt(10 * time.Minute)},
+			want:    30 * time.Second,
+			wantOK:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := newestSampleAge(tt.samples, now)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("newestSampleAge() = %s, %t, want %s, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCheckUsageStaleness(t *testing.T) {
+	savedStaleness, savedInstant := maxStaleness, evaluationInstant
+	t.Cleanup(func() {
+		maxStaleness, evaluationInstant = savedStaleness, savedInstant
+		staleWarningPrinted.Store(false)
+	})
+	maxStaleness = 5 * time.Minute
+	evaluationInstant = time.Unix(1700000000, 0)
+
+	for _, tt := range []struct {
+		name      string
+		newest    time.Duration
+		wantStale bool
+	}{
+		{name: "fresh", newest: time.Minute},
+		{name: "stale", newest: 20 * time.Minute, wantStale: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			staleWarningPrinted.Store(false)
+			sampleTime := evaluationInstant.Add(-tt.newest).Unix()
+			newPrometheusStub(t, respondWith(http.StatusOK, fmt.Sprintf(
+				`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"%d"]}]}}`, sampleTime)))
+
+			stderr := captureStderr(t, func() { checkUsageStaleness(context.Background(), "a") })
+			if stale := strings.Contains(stderr, "is 20m old"); stale != tt.wantStale {
+				t.Errorf("stderr = %q, want a stale warning: %t", stderr, tt.wantStale)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// showQueryStats prints a summary of the Prometheus query durations at the end of the run when set by --metrics
+var showQueryStats bool
+
+// queryStats accumulates the durations of the requests sent to Prometheus. Cached responses are not counted.
+// It is shared by the namespaces queried in parallel.
+var queryStats = struct {
+	sync.Mutex
+	count int
+	total time.Duration
+	min   time.Duration
+	max   time.Duration
+}{}
+
+// recordQueryDuration adds the duration of a request to the query statistics
+func recordQueryDuration(duration time.Duration) {
+	queryStats.Lock()
+	defer queryStats.Unlock()
+
+	if queryStats.count == 0 || duration < queryStats.min {
+		queryStats.min = duration
+	}
+	if duration > queryStats.max {
+		queryStats.max = duration
+	}
+	queryStats.count++
+	queryStats.total += duration
+}
+
+// printQueryStats writes the number of requests sent to Prometheus and their min, max and average duration
+func printQueryStats(w io.Writer) {
+	queryStats.Lock()
+	defer queryStats.Unlock()
+
+	if queryStats.count == 0 {
+		fmt.Fprintln(w, "Prometheus queries: 0")
+		return
+	}
+	avg := queryStats.total / time.Duration(queryStats.count)
+	fmt.Fprintf(w, "Prometheus queries: %d (min %s, max %s, avg %s, total %s)\n",
+		queryStats.count,
+		queryStats.min.Round(time.Millisecond),
+		queryStats.max.Round(time.Millisecond),
+		avg.Round(time.Millisecond),
+		queryStats.total.Round(time.Millisecond))
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// pvcFullThreshold is the percentage of its capacity above which a PersistentVolumeClaim is flagged as nearly full
+var pvcFullThreshold float64
+
+// addPVCFullThresholdFlag registers the --pvc-full-threshold flag on a command
+func addPVCFullThresholdFlag(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&pvcFullThreshold, "pvc-full-threshold", 85, "Flag PersistentVolumeClaims using more than this percentage of their capacity with --resource storage")
+}
+
+// pvcUsage is the disk usage of a PersistentVolumeClaim as reported by the kubelet of the node mounting it
+type pvcUsage struct {
+	Namespace             string   `json:"namespace"`
+	PersistentVolumeClaim string   `json:"persistentVolumeClaim"`
+	Used                  float64  `json:"used"`     // Bytes used
+	Capacity              float64  `json:"capacity"` // Bytes available to the volume
+	UsedPct               *float64 `json:"usedPct"`  // Used as a percentage of capacity, nil when the capacity is zero
+	// NearlyFull is set when more than --pvc-full-threshold of the capacity is used
+	NearlyFull bool `json:"nearlyFull,omitempty"`
+}
+
+// queryPVCUsage returns the usage of every mounted PersistentVolumeClaim of a namespace, fullest first.
+// Claims that are not mounted have no kubelet volume stats and are not listed.
+func queryPVCUsage(ctx context.Context, namespace string) ([]pvcUsage, error) {
+	used, err := queryPrometheusVector(ctx, pvcUsedBytesQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying PVC usage: %w", err)
+	}
+	capacity, err := queryPrometheusVector(ctx, pvcCapacityBytesQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying PVC capacity: %w", err)
+	}
+
+	type claimKey struct{ namespace, claim string }
+	capacityByClaim := map[claimKey]float64{}
+	for _, sample := range capacity {
+		capacityByClaim[claimKey{sample.Metric["namespace"], sample.Metric["persistentvolumeclaim"]}] = sample.Value
+	}
+
+	claims := make([]pvcUsage, 0, len(used))
+	for _, sample := range used {
+		claim := pvcUsage{
+			Namespace:             sample.Metric["namespace"],
+			PersistentVolumeClaim: sample.Metric["persistentvolumeclaim"],
+			Used:                  sample.Value,
+			Capacity:              capacityByClaim[claimKey{sample.Metric["namespace"], sample.Metric["persistentvolumeclaim"]}],
+		}
+		if claim.Capacity > 0 {
+			pct := claim.Used / claim.Capacity * 100
+			claim.UsedPct = &pct
+			claim.NearlyFull = pct > pvcFullThreshold
+		}
+		claims = append(claims, claim)
+	}
+	sort.Slice(claims, func(i, j int) bool {
+		return pvcUsedPct(claims[i]) > pvcUsedPct(claims[j])
+	})
+	return claims, nil
+}
+
+// pvcUsedPct returns the used percentage of a claim for sorting, -1 when it is unknown
+func pvcUsedPct(claim pvcUsage) float64 {
+	if claim.UsedPct == nil {
+		return -1
+	}
+	return *claim.UsedPct
+}
+
+// pvcDisplayName returns the name of a claim, qualified with its namespace when reporting on all namespaces
+func pvcDisplayName(namespace string, claim pvcUsage) string {
+	if namespace == "" {
+		return claim.Namespace + "/" + claim.PersistentVolumeClaim
+	}
+	return claim.PersistentVolumeClaim
+}
+
+// formatPVCUsedPct formats the used percentage of a claim
+func formatPVCUsedPct(claim pvcUsage) string {
+	if claim.UsedPct == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.*f%%", decimals(1), *claim.UsedPct)
+}
+
+// printPVCUsage prints the usage of the claims of a namespace in text format
+func printPVCUsage(namespace string, claims []pvcUsage) {
+	if len(claims) == 0 {
+		fmt.Printf("  No PersistentVolumeClaim usage found for %s (no mounted claims or kubelet volume stats unavailable)\n", describeNamespace(namespace))
+		return
+	}
+	fmt.Println("  PersistentVolumeClaims:")
+	for _, claim := range claims {
+		fmt.Printf("    %s: %s/%s (%s)", pvcDisplayName(namespace, claim), formatMemory(claim.Used), formatMemory(claim.Capacity), formatPVCUsedPct(claim))
+		if claim.NearlyFull {
+			fmt.Print(" nearly full")
+		}
+		fmt.Println()
+	}
+}
+
+// printPVCUsageTable prints the usage of the claims of a namespace as an aligned table
+func printPVCUsageTable(namespace string, claims []pvcUsage) {
+	if len(claims) == 0 {
+		fmt.Println("No PersistentVolumeClaim usage found")
+		return
+	}
+	rows := make([][]string, 0, len(claims))
+	for _, claim := range claims {
+		status := ""
+		if claim.NearlyFull {
+			status = colorize("Nearly full", colorRed)
+		}
+		usedPct := formatPVCUsedPct(claim)
+		if claim.UsedPct != nil {
+			usedPct = colorizeStatus(usedPct, claim.NearlyFull)
+		}
+		rows = append(rows, []string{pvcDisplayName(namespace, claim), formatMemory(claim.Used), formatMemory(claim.Capacity), usedPct, status})
+	}
+	fmt.Print(renderTable([]string{"PVC", "USED", "CAPACITY", "USED%", "STATUS"}, rows))
+}
+
+// warnNearlyFullPVCs reports the claims above --pvc-full-threshold on stderr
+func warnNearlyFullPVCs(results []analysis) {
+	for _, result := range results {
+		for _, claim := range result.Storage {
+			if claim.NearlyFull {
+				fmt.Fprintf(os.Stderr, "Warning: PersistentVolumeClaim %s/%s is %s full, above %g%%\n",
+					claim.Namespace, claim.PersistentVolumeClaim, formatPVCUsedPct(claim), pvcFullThreshold)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// resourceSummary compares the amount of a resource requested across the cluster with the amount allocatable
+type resourceSummary struct {
+	Requested   float64 `json:"requested"`   // Cores for CPU, bytes for memory
+	Allocatable float64 `json:"allocatable"` // Cores for CPU, bytes for memory
+	// OvercommitRatio is requested over allocatable, above 1 when more is requested than the nodes can hold.
+	// It is nil when nothing is allocatable.
+	OvercommitRatio *float64 `json:"overcommitRatio"`
+}
+
+// clusterSummary is the output of the summary command
+type clusterSummary struct {
+	CPU    resourceSummary `json:"cpu"`
+	Memory resourceSummary `json:"memory"`
+}
+
+// summaryCmd represents the summary command
+var summaryCmd = &cobra.Command{
+	Use:   "summary",
+	Short: "Summarize the CPU and memory requested across the cluster against what the nodes can allocate",
+	Long: `Summary adds up the CPU and memory requested by every container in the cluster and
+compares it with the CPU and memory allocatable across all nodes, as reported by
+kube-state-metrics. The overcommit ratio is requested over allocatable.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		cpu, err := queryResourceSummary(ctx, "cpu")
+		if err != nil {
+			return err
+		}
+		memory, err := queryResourceSummary(ctx, "memory")
+		if err != nil {
+			return err
+		}
+		summary := clusterSummary{CPU: cpu, Memory: memory}
+
+		if outputFormat == "json" {
+			return printJSON(summary)
+		}
+		if summary.CPU.Allocatable == 0 && summary.Memory.Allocatable == 0 {
+			fmt.Println("No node allocatable data found (kube-state-metrics unavailable)")
+			return nil
+		}
+		if outputFormat == "table" {
+			fmt.Print(renderTable([]string{"RESOURCE", "REQUESTED", "ALLOCATABLE", "REQUESTED%"}, [][]string{
+				{"cpu", formatCPU(summary.CPU.Requested), formatCPU(summary.CPU.Allocatable), formatOvercommit(summary.CPU)},
+				{"memory", formatMemory(summary.Memory.Requested), formatMemory(summary.Memory.Allocatable), formatOvercommit(summary.Memory)},
+			}))
+			return nil
+		}
+		fmt.Printf("CPU:    %s of %s allocatable requested (%s)\n", formatCPU(summary.CPU.Requested), formatCPU(summary.CPU.Allocatable), formatOvercommit(summary.CPU))
+		fmt.Printf("Memory: %s of %s allocatable requested (%s)\n", formatMemory(summary.Memory.Requested), formatMemory(summary.Memory.Allocatable), formatOvercommit(summary.Memory))
+		return nil
+	},
+}
+
+// queryResourceSummary returns the amount of a resource, cpu or memory, requested and allocatable across the cluster.
+// A cluster without data for one of them counts as zero.
+func queryResourceSummary(ctx context.Context, resource string) (resourceSummary, error) {
+	var summary resourceSummary
+	var err error
+	summary.Allocatable, err = queryPrometheusValue(ctx, clusterAllocatableQuery(resource))
+	if err != nil && !errors.Is(err, errNoData) {
+		return summary, fmt.Errorf("querying allocatable %s: %w", resource, err)
+	}
+	summary.Requested, err = queryPrometheusValue(ctx, clusterRequestsQuery(resource))
+	if err != nil && !errors.Is(err, errNoData) {
+		return summary, fmt.Errorf("querying requested %s: %w", resource, err)
+	}
+	if summary.Allocatable > 0 {
+		ratio := summary.Requested / summary.Allocatable
+		summary.OvercommitRatio = &ratio
+	}
+	return summary, nil
+}
+
+// formatOvercommit formats the requested share of the allocatable amount of a resource as a percentage, flagging
+// overcommitted resources
+func formatOvercommit(summary resourceSummary) string {
+	if summary.OvercommitRatio == nil {
+		return "-"
+	}
+	if *summary.OvercommitRatio > 1 {
+		return fmt.Sprintf("%.*f%%, overcommitted", decimals(1), *summary.OvercommitRatio*100)
+	}
+	return fmt.Sprintf("%.*f%%", decimals(1), *summary.OvercommitRatio*100)
+}
+
+func init() {
+	rootCmd.AddCommand(summaryCmd)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+)
+
+// queryTemplateNames are the queries that can be replaced in the queries section of the config file
+var queryTemplateNames = []string{
+	"cpu_usage_by_namespace",
+	"cpu_requests_by_namespace",
+	"network_receive_by_namespace",
+	"network_transmit_by_namespace",
+	"quotas_by_namespace",
+	"cpu_usage_by_container",
+}
+
+// cpuRecordingRuleKey is the config key of a recording rule pre-aggregating the CPU usage by namespace, which
+// replaces the rate() over the raw container series
+const cpuRecordingRuleKey = "cpu_recording_rule"
+
+// cpuRecordingRule is the metric set with queries.cpu_recording_rule, empty to use the raw series
+var cpuRecordingRule string
+
+// metricNamePattern matches valid Prometheus metric names, including the colons of recording rules
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// queryTemplateData is what a query template is rendered with
+type queryTemplateData struct {
+	Namespace  string // Empty for all namespaces
+	Pod        string // Only set for cpu_usage_by_container
+	Labels     string // Matchers from --label joined by commas, empty if there are none
+	RateWindow string // --rate-window as a Prometheus duration, e.g. 5m
+}
+
+// queryTemplates holds the parsed templates of the queries section of the config file by name
+var queryTemplates = map[string]*template.Template{}
+
+// loadQueryTemplates parses the PromQL templates of the queries section of the config file, which replace the
+// built-in queries of the same name. Every template is rendered once so that mistakes fail before any query runs.
+func loadQueryTemplates() error {
+	queryTemplates = map[string]*template.Template{}
+	cpuRecordingRule = ""
+	for name, text := range viper.GetStringMapString("queries") {
+		if name == cpuRecordingRuleKey {
+			if !metricNamePattern.MatchString(text) {
+				return fmt.Errorf("invalid queries.%s %q: must be a metric name such as namespace:container_cpu_usage:sum", cpuRecordingRuleKey, text)
+			}
+			cpuRecordingRule = text
+			continue
+		}
+		if !slices.Contains(queryTemplateNames, name) {
+			return fmt.Errorf("unknown query %q in the queries section of the config file: must be one of %s", name, strings.Join(append(queryTemplateNames, cpuRecordingRuleKey), ", "))
+		}
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return fmt.Errorf("parsing query template %s: %w", name, err)
+		}
+		if err := tmpl.Execute(&strings.Builder{}, queryTemplateData{Namespace: "default", Pod: "pod", RateWindow: "5m"}); err != nil {
+			return fmt.Errorf("rendering query template %s: %w", name, err)
+		}
+		queryTemplates[name] = tmpl
+	}
+	if _, ok := queryTemplates["cpu_usage_by_namespace"]; ok && cpuRecordingRule != "" {
+		return fmt.Errorf("queries.cpu_usage_by_namespace and queries.%s can't both be set", cpuRecordingRuleKey)
+	}
+	return nil
+}
+
+// renderQueryTemplate renders the configured template of a query. The boolean is false when there is none,
+// in which case the built-in query is used.
+func renderQueryTemplate(name, namespace, pod string) (string, bool) {
+	tmpl, ok := queryTemplates[name]
+	if !ok {
+		return "", false
+	}
+	var b strings.Builder
+	data := queryTemplateData{
+		Namespace:  namespace,
+		Pod:        pod,
+		Labels:     strings.Join(extraMatchers, ", "),
+		RateWindow: formatPrometheusDuration(rateWindow),
+	}
+	// Templates were checked when they were loaded, so this only fails on a template misusing the data
+	if err := tmpl.Execute(&b, data); err != nil {
+		logger.Warn("Using the built-in query since the configured template failed", "query", name, "error", err)
+		return "", false
+	}
+	return b.String(), true
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// exitCodeOverProvisioned is the exit status when usage falls below --fail-over-ratio of the requests
+const exitCodeOverProvisioned = 2
+
+// failOverRatio is the fraction of requested CPU below which usage counts as over-provisioned; 0 disables the check
+var failOverRatio float64
+
+// addFailOverRatioFlag registers the --fail-over-ratio flag on a command
+func addFailOverRatioFlag(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&failOverRatio, "fail-over-ratio", 0, "Exit with status 2 when CPU usage is below this fraction of the CPU requests, e.g. 0.2 (default is disabled)")
+}
+
+// validateFailOverRatio checks that the ratio is a fraction between 0 and 1
+func validateFailOverRatio() error {
+	if failOverRatio < 0 || failOverRatio > 1 {
+		return fmt.Errorf("invalid fail-over-ratio %g: must be between 0 and 1", failOverRatio)
+	}
+	return nil
+}
+
+// evaluateThreshold reports whether usage is below ratio of requests. Nothing is breached when no requests are set.
+func evaluateThreshold(usage, requests, ratio float64) (breached bool) {
+	if requests <= 0 {
+		return false
+	}
+	return usage < requests*ratio
+}
+
+// overProvisionedError reports the over-provisioned targets on stderr and returns an error exiting with
+// exitCodeOverProvisioned if there are any
+func overProvisionedError(targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	for _, target := range targets {
+		fmt.Fprintf(os.Stderr, "Over-provisioned: %s uses less than %.0f%% of its requested CPU\n", target, failOverRatio*100)
+	}
+	return &exitError{
+		code: exitCodeOverProvisioned,
+		err:  fmt.Errorf("%d over-provisioned target(s) found", len(targets)),
+	}
+}
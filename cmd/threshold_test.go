@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateThreshold(t *testing.T) {
+	tests := []struct {
+		name                   string
+		usage, requests, ratio float64
+		want                   bool
+	}{
+		{name: "usage below ratio of requests", usage: 0.1, requests: 1, ratio: 0.5, want: true},
+		{name: "usage at ratio of requests", usage: 0.5, requests: 1, ratio: 0.5, want: false},
+		{name: "usage above ratio of requests", usage: 0.8, requests: 1, ratio: 0.5, want: false},
+		{name: "no requests", usage: 0.1, requests: 0, ratio: 0.5, want: false},
+		{name: "disabled", usage: 0.1, requests: 1, ratio: 0, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluateThreshold(tt.usage, tt.requests, tt.ratio); got != tt.want {
+				t.Errorf("evaluateThreshold(%g, %g, %g) = %t, want %t", tt.usage, tt.requests, tt.ratio, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverProvisionedError(t *testing.T) {
+	savedRatio := failOverRatio
+	t.Cleanup(func() { failOverRatio = savedRatio })
+	failOverRatio = 0.2
+
+	if err := overProvisionedError(nil); err != nil {
+		t.Errorf("overProvisionedError(nil) = %v, want nil", err)
+	}
+
+	var err error
+	stderr := captureStderr(t, func() { err = overProvisionedError([]string{"namespace 'a'", "namespace 'b'"}) })
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != exitCodeOverProvisioned || exitCodeOverProvisioned != 2 {
+		t.Fatalf("error = %v, want an exit error with code 2", err)
+	}
+	if !strings.Contains(err.Error(), "2 over-provisioned target(s)") {
+		t.Errorf("error = %q, want the number of targets", err)
+	}
+	want := "Over-provisioned: namespace 'a' uses less than 20% of its requested CPU\n"
+	if !strings.HasPrefix(stderr, want) || !strings.Contains(stderr, "namespace 'b'") {
+		t.Errorf("stderr = %q, want every target reported", stderr)
+	}
+}
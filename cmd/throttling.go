@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// throttleThreshold is the fraction of CFS periods above which a throttled pod is flagged
+var throttleThreshold float64
+
+// addThrottleThresholdFlag registers the --throttle-threshold flag on a command
+func addThrottleThresholdFlag(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&throttleThreshold, "throttle-threshold", 0.25, "Flag pods throttled in more than this fraction of their CPU periods with --resource throttling")
+}
+
+// validateThrottleThreshold checks --throttle-threshold
+func validateThrottleThreshold() error {
+	if throttleThreshold < 0 || throttleThreshold > 1 {
+		return fmt.Errorf("invalid throttle threshold %g: must be between 0 and 1", throttleThreshold)
+	}
+	return nil
+}
+
+// podThrottling is how often the CPU limits of the containers of a pod throttled them over the rate window
+type podThrottling struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	// ThrottledRatio is the fraction of CFS periods in which the pod was throttled, nil when it ran no periods
+	ThrottledRatio *float64 `json:"throttledRatio"`
+	// Throttled is set when the ratio is above --throttle-threshold
+	Throttled bool `json:"throttled,omitempty"`
+}
+
+// throttledRatio returns the fraction of CFS periods that were throttled, or false when no periods elapsed
+func throttledRatio(throttledPeriods, periods float64) (float64, bool) {
+	if periods <= 0 {
+		return 0, false
+	}
+	return throttledPeriods / periods, true
+}
+
+// queryCPUThrottling returns the CPU throttling of the pods of a namespace that have CPU limits, most throttled first.
+// Pods without CPU limits run no CFS periods and are not listed.
+func queryCPUThrottling(ctx context.Context, namespace string) ([]podThrottling, error) {
+	periods, err := queryPrometheusVector(ctx, podCPUPeriodsQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying CPU periods: %w", err)
+	}
+	throttled, err := queryPrometheusVector(ctx, podCPUThrottledPeriodsQuery(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("querying throttled CPU periods: %w", err)
+	}
+
+	type podKey struct{ namespace, pod string }
+	throttledByPod := map[podKey]float64{}
+	for _, sample := range throttled {
+		throttledByPod[podKey{sample.Metric["namespace"], sample.Metric["pod"]}] = sample.Value
+	}
+
+	pods := make([]podThrottling, 0, len(periods))
+	for _, sample := range periods {
+		key := podKey{sample.Metric["namespace"], sample.Metric["pod"]}
+		pod := podThrottling{Namespace: key.namespace, Pod: key.pod}
+		if ratio, ok := throttledRatio(throttledByPod[key], sample.Value); ok {
+			pod.ThrottledRatio = &ratio
+			pod.Throttled = ratio > throttleThreshold
+		}
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		ri, rj := throttledRatioOrUnknown(pods[i]), throttledRatioOrUnknown(pods[j])
+		if ri != rj {
+			return ri > rj
+		}
+		return podThrottlingDisplayName("", pods[i]) < podThrottlingDisplayName("", pods[j])
+	})
+	return pods, nil
+}
+
+// throttledRatioOrUnknown returns the throttled ratio of a pod for sorting, -1 when it is unknown
+func throttledRatioOrUnknown(pod podThrottling) float64 {
+	if pod.ThrottledRatio == nil {
+		return -1
+	}
+	return *pod.ThrottledRatio
+}
+
+// podThrottlingDisplayName returns the name of a pod, qualified with its namespace when reporting on all namespaces
+func podThrottlingDisplayName(namespace string, pod podThrottling) string {
+	if namespace == "" {
+		return pod.Namespace + "/" + pod.Pod
+	}
+	return pod.Pod
+}
+
+// formatThrottledRatio formats the throttled ratio of a pod as a percentage of its CPU periods
+func formatThrottledRatio(pod podThrottling) string {
+	if pod.ThrottledRatio == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.*f%%", decimals(1), *pod.ThrottledRatio*100)
+}
+
+// printCPUThrottling prints the CPU throttling of the pods of a namespace in text format
+func printCPUThrottling(namespace string, pods []podThrottling) {
+	if len(pods) == 0 {
+		fmt.Printf("  No CPU throttling data found for %s (no pods with CPU limits or metric unavailable)\n", describeNamespace(namespace))
+		return
+	}
+	fmt.Println("  CPU periods throttled by pod:")
+	shown, more := limitRows(pods)
+	for _, pod := range shown {
+		fmt.Printf("    %s: %s", podThrottlingDisplayName(namespace, pod), formatThrottledRatio(pod))
+		if pod.Throttled {
+			fmt.Print(" throttled")
+		}
+		fmt.Println()
+	}
+	printMoreRows("    ", more)
+}
+
+// printCPUThrottlingTable prints the CPU throttling of the pods of a namespace as an aligned table
+func printCPUThrottlingTable(namespace string, pods []podThrottling) {
+	if len(pods) == 0 {
+		fmt.Println("No CPU throttling data found")
+		return
+	}
+	shown, more := limitRows(pods)
+	rows := make([][]string, 0, len(shown))
+	for _, pod := range shown {
+		status := ""
+		if pod.Throttled {
+			status = colorize("Throttled", colorRed)
+		}
+		ratio := formatThrottledRatio(pod)
+		if pod.ThrottledRatio != nil {
+			ratio = colorizeStatus(ratio, pod.Throttled)
+		}
+		rows = append(rows, []string{podThrottlingDisplayName(namespace, pod), ratio, status})
+	}
+	fmt.Print(renderTable([]string{"POD", "THROTTLED", "STATUS"}, rows))
+	printMoreRows("", more)
+}
+
+// warnThrottledPods reports the pods throttled above --throttle-threshold on stderr
+func warnThrottledPods(results []analysis) {
+	for _, result := range results {
+		for _, pod := range result.Throttling {
+			if pod.Throttled {
+				fmt.Fprintf(os.Stderr, "Warning: pod %s/%s is throttled in %s of its CPU periods, above %g%%\n",
+					pod.Namespace, pod.Pod, formatThrottledRatio(pod), throttleThreshold*100)
+			}
+		}
+	}
+}
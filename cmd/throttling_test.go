@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestThrottledRatio(t *testing.T) {
+	tests := []struct {
+		name                      string
+		throttledPeriods, periods float64
+		want                      float64
+		wantOK                    bool
+	}{
+		{name: "never throttled", throttledPeriods: 0, periods: 100, want: 0, wantOK: true},
+		{name: "throttled in half the periods", throttledPeriods: 50, periods: 100, want: 0.5, wantOK: true},
+		{name: "no periods", throttledPeriods: 0, periods: 0, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := throttledRatio(tt.throttledPeriods, tt.periods)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("throttledRatio(%g, %g) = %g, %t, want %g, %t", tt.throttledPeriods, tt.periods, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestQueryCPUThrottling(t *testing.T) {
+	savedThreshold := throttleThreshold
+	t.Cleanup(func() { throttleThreshold = savedThreshold })
+	throttleThreshold = 0.25
+
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.FormValue("query"), "container_cpu_cfs_throttled_periods_total") {
+			// The idle pod ran no periods and the unthrottled pod is missing from the throttled vector
+			respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"namespace":"a","pod":"busy"},"value":[1700000000,"40"]},
+				{"metric":{"namespace":"a","pod":"calm"},"value":[1700000000,"10"]},
+				{"metric":{"namespace":"a","pod":"idle"},"value":[1700000000,"0"]}
+			]}}`)(w, r)
+			return
+		}
+		respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"namespace":"a","pod":"busy"},"value":[1700000000,"100"]},
+			{"metric":{"namespace":"a","pod":"calm"},"value":[1700000000,"100"]},
+			{"metric":{"namespace":"a","pod":"idle"},"value":[1700000000,"0"]},
+			{"metric":{"namespace":"a","pod":"unthrottled"},"value":[1700000000,"100"]}
+		]}}`)(w, r)
+	})
+
+	pods, err := queryCPUThrottling(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Most throttled first, pods without periods last
+	want := []struct {
+		pod       string
+		ratio     string
+		throttled bool
+	}{
+		{pod: "busy", ratio: "40.0%", throttled: true},
+		{pod: "calm", ratio: "10.0%"},
+		{pod: "unthrottled", ratio: "0.0%"},
+		{pod: "idle", ratio: "-"},
+	}
+	if len(pods) != len(want) {
+		t.Fatalf("got %d pods, want %d: %+v", len(pods), len(want), pods)
+	}
+	for i, w := range want {
+		pod := pods[i]
+		if pod.Pod != w.pod || formatThrottledRatio(pod) != w.ratio || pod.Throttled != w.throttled {
+			t.Errorf("pod %d = %s at %s, throttled %t, want %s at %s, throttled %t",
+				i, pod.Pod, formatThrottledRatio(pod), pod.Throttled, w.pod, w.ratio, w.throttled)
+		}
+	}
+	if pods[3].ThrottledRatio != nil {
+		t.Errorf("ratio of a pod without periods = %g, want none", *pods[3].ThrottledRatio)
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// topCount is the number of namespaces ranked by the top command
+	topCount int
+	// topResource is the resource the namespaces are ranked by: cpu or memory
+	topResource string
+)
+
+// topEntry is a namespace ranked by its usage of a resource
+type topEntry struct {
+	Rank      int     `json:"rank"`
+	Namespace string  `json:"namespace"`
+	Usage     float64 `json:"usage"` // Cores for cpu, bytes for memory
+}
+
+// topCmd represents the top command
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Rank the namespaces using the most CPU or memory across the cluster",
+	Long: `Top ranks the --top namespaces using the most CPU (in cores, averaged over --rate-window)
+or memory (working set) across the cluster.`,
+	Example: `  k top
+  k top --resource memory --top 5`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if topCount < 1 {
+			return fmt.Errorf("--top must be at least 1")
+		}
+		switch topResource {
+		case "cpu", "memory":
+		default:
+			return fmt.Errorf("invalid resource %q: must be one of cpu, memory", topResource)
+		}
+		if err := validateSort("name", "usage"); err != nil {
+			return err
+		}
+		if err := validateLimit(); err != nil {
+			return err
+		}
+		return validateRateWindow()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := topNamespacesCPUUsageQuery(topCount)
+		format := formatCPU
+		if topResource == "memory" {
+			query = topNamespacesMemoryUsageQuery(topCount)
+			format = formatMemory
+		}
+
+		samples, err := queryPrometheusVector(cmd.Context(), query)
+		if err != nil {
+			return fmt.Errorf("querying top namespaces by %s: %w", topResource, err)
+		}
+		// topk does not order its result
+		sort.Slice(samples, func(i, j int) bool { return samples[i].Value > samples[j].Value })
+
+		entries := make([]topEntry, 0, len(samples))
+		for i, sample := range samples {
+			entries = append(entries, topEntry{Rank: i + 1, Namespace: sample.Metric["namespace"], Usage: sample.Value})
+		}
+		// Entries keep their rank when ordered by name
+		sortRows(entries,
+			func(e topEntry) string { return e.Namespace },
+			func(e topEntry) *float64 { return &e.Usage },
+			nil,
+		)
+
+		if outputFormat == "json" {
+			return printJSON(entries)
+		}
+
+		if len(entries) == 0 {
+			fmt.Printf("No %s usage data found (no running pods or metric unavailable)\n", topResource)
+			return nil
+		}
+
+		shown, more := limitRows(entries)
+		if outputFormat == "table" {
+			rows := make([][]string, 0, len(shown))
+			for _, entry := range shown {
+				rows = append(rows, []string{strconv.Itoa(entry.Rank), entry.Namespace, format(entry.Usage)})
+			}
+			fmt.Print(renderTable([]string{"RANK", "NAMESPACE", "USAGE"}, rows))
+			printMoreRows("", more)
+			return nil
+		}
+		fmt.Printf("Top %d namespaces by %s usage:\n", topCount, topResource)
+		for _, entry := range shown {
+			fmt.Printf("  %2d. %s: %s\n", entry.Rank, entry.Namespace, format(entry.Usage))
+		}
+		printMoreRows("  ", more)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+
+	topCmd.Flags().IntVar(&topCount, "top", 10, "Number of namespaces to show")
+	topCmd.Flags().StringVar(&topResource, "resource", "cpu", "Resource to rank the namespaces by: cpu or memory")
+	addRateWindowFlag(topCmd)
+	addSortFlags(topCmd, "name", "usage")
+	addLimitFlag(topCmd)
+}
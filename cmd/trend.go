@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// trendRange is how far back the trend reaches
+const trendRange = 24 * time.Hour
+
+// trendPoint is a single point of the CPU usage trend
+type trendPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	CPU       string    `json:"cpu"`
+}
+
+// namespaceTrend is the CPU usage trend of a namespace, or of the whole cluster for an empty namespace
+type namespaceTrend struct {
+	Namespace string       `json:"namespace"`
+	Points    []trendPoint `json:"points"`
+}
+
+// trendCmd represents the trend command
+var trendCmd = &cobra.Command{
+	Use:   "trend",
+	Short: "Show the CPU usage of namespaces over the last 24 hours",
+	Long: `Trend shows the CPU usage of namespaces over the last 24 hours, with one point per
+--step (one minute by default). With -A it shows the CPU usage of the whole cluster.`,
+	Example: `  k trend -n team-a
+  k trend -n team-a,team-b --step 5m
+  k trend -A`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateConcurrency(); err != nil {
+			return err
+		}
+		if err := validateAggregation(); err != nil {
+			return err
+		}
+		return validateRateWindow()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespaces, err := namespacesFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if err := validateNamespacesExist(cmd, namespaces); err != nil {
+			return err
+		}
+
+		step := viper.GetDuration("prometheus.step")
+		if err := confirmExpensiveQuery(namespaces, trendRange, step); err != nil {
+			return err
+		}
+
+		end := evaluationNow()
+		results, namespaceErr := runPerNamespace(namespaces, func(namespace string) (namespaceTrend, error) {
+			return queryTrend(cmd.Context(), namespace, end, step)
+		})
+		if len(results) == 0 && namespaceErr != nil {
+			return namespaceErr
+		}
+
+		// A single namespace is rendered as its points to keep the output of single-namespace runs unchanged
+		if outputFormat == "json" {
+			if len(namespaces) == 1 {
+				err = printJSON(results[0].Points)
+			} else {
+				err = printJSON(results)
+			}
+			if err != nil {
+				return err
+			}
+			return namespaceErr
+		}
+
+		for i, result := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			printTrend(result)
+		}
+		return namespaceErr
+	},
+}
+
+// queryTrend returns the CPU usage of a namespace over the trendRange before end, one point per step
+func queryTrend(ctx context.Context, namespace string, end time.Time, step time.Duration) (namespaceTrend, error) {
+	result := namespaceTrend{Namespace: namespace, Points: []trendPoint{}}
+	series, err := queryPrometheusRange(ctx, namespaceCPUUsageQuery(namespace), end.Add(-trendRange), end, step)
+	if err != nil {
+		return result, fmt.Errorf("querying CPU usage of %s: %w", describeNamespace(namespace), err)
+	}
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			result.Points = append(result.Points, trendPoint{Timestamp: sample.Timestamp.UTC(), CPU: formatCPU(sample.Value)})
+		}
+	}
+	return result, nil
+}
+
+// printTrend prints the CPU usage trend of a namespace in text or table format
+func printTrend(result namespaceTrend) {
+	if len(result.Points) == 0 {
+		fmt.Printf("No CPU usage data found for %s (no running pods or metric unavailable)\n", describeNamespace(result.Namespace))
+		return
+	}
+
+	fmt.Printf("CPU usage for %s over the last %.0f hours:\n", describeNamespace(result.Namespace), trendRange.Hours())
+	if outputFormat == "table" {
+		rows := make([][]string, 0, len(result.Points))
+		for _, point := range result.Points {
+			rows = append(rows, []string{point.Timestamp.Format(time.RFC3339), point.CPU})
+		}
+		fmt.Print(renderTable([]string{"TIME", "CPU"}, rows))
+		return
+	}
+	for _, point := range result.Points {
+		fmt.Printf("  %s  %s\n", point.Timestamp.Format(time.RFC3339), point.CPU)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(trendCmd)
+
+	addNamespaceFlags(trendCmd)
+	addRateWindowFlag(trendCmd)
+	addAggregationFlag(trendCmd)
+	addConcurrencyFlag(trendCmd)
+	trendCmd.Flags().Duration("step", time.Minute, "Resolution of the trend (overrides prometheus.step from the config file)")
+	viper.BindPFlag("prometheus.step", trendCmd.Flags().Lookup("step"))
+}
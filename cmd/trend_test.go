@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryTrend(t *testing.T) {
+	useAggregation(t, "sum")
+	var queries []string
+	newPrometheusStub(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.FormValue("query"))
+		respondWith(http.StatusOK, `{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{},"values":[[1700000000,"0.25"],[1700000060,"1.5"]]}
+		]}}`)(w, r)
+	})
+	end := time.Unix(1700000060, 0)
+
+	for _, namespace := range []string{"a", ""} {
+		result, err := queryTrend(context.Background(), namespace, end, time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Namespace != namespace || len(result.Points) != 2 {
+			t.Fatalf("trend = %+v, want two points of %s", result, describeNamespace(namespace))
+		}
+		if result.Points[0].CPU != "250m" || !result.Points[1].Timestamp.Equal(end) {
+			t.Errorf("points = %+v, want 250m first and the last at %s", result.Points, end)
+		}
+	}
+	// All namespaces is the usage of the whole cluster
+	if !strings.Contains(queries[0], `namespace="a"`) || strings.Contains(queries[1], "namespace=") {
+		t.Errorf("queries = %q, want namespace a and then the whole cluster", queries)
+	}
+}
+
+func TestTrendNamespaceFlags(t *testing.T) {
+	for _, name := range []string{"namespace", "namespace-file", "all-namespaces", "no-validate-namespace", "concurrency"} {
+		if trendCmd.Flags().Lookup(name) == nil {
+			t.Errorf("trend has no --%s flag", name)
+		}
+	}
+}
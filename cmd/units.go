@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Binary memory units as used by Kubernetes quantities
+const (
+	kibibyte = 1024.0
+	mebibyte = 1024 * kibibyte
+	gibibyte = 1024 * mebibyte
+	tebibyte = 1024 * gibibyte
+)
+
+// precision is the number of decimals numbers are rendered with in text, table and CSV output, set by --precision.
+// When negative every kind of value keeps its own number of decimals.
+var precision = -1
+
+// decimals returns --precision, or def when it is not set
+func decimals(def int) int {
+	if precision < 0 {
+		return def
+	}
+	return precision
+}
+
+// roundTo rounds value to a number of decimals and formats it without trailing zeros
+func roundTo(value float64, decimals int) string {
+	scale := math.Pow(10, float64(decimals))
+	return strconv.FormatFloat(math.Round(value*scale)/scale, 'f', -1, 64)
+}
+
+// formatCPU formats cores in Kubernetes units: millicores below one core (234m), otherwise cores with up to two
+// decimals (1.5), or --precision decimals. Usage too small to show as a millicore is shown as 1m rather than 0, to
+// tell it apart from none.
+func formatCPU(cores float64) string {
+	switch {
+	case cores <= 0:
+		return "0"
+	case cores < 0.001:
+		return "1m"
+	case math.Round(cores*1000) < 1000:
+		return fmt.Sprintf("%.0fm", cores*1000)
+	}
+	return roundTo(cores, decimals(2))
+}
+
+// formatMemory formats bytes in the largest binary unit that keeps the value at least 1, e.g. 512Mi or 2.3Gi.
+// Values below 10 of a unit keep one decimal, larger ones are rounded to whole units.
+func formatMemory(bytes float64) string {
+	if bytes <= 0 {
+		return "0"
+	}
+	for _, unit := range []struct {
+		size   float64
+		suffix string
+	}{{tebibyte, "Ti"}, {gibibyte, "Gi"}, {mebibyte, "Mi"}, {kibibyte, "Ki"}} {
+		if bytes >= unit.size {
+			return formatUnits(bytes/unit.size) + unit.suffix
+		}
+	}
+	return fmt.Sprintf("%.0f", bytes)
+}
+
+// formatUnits formats a value of at least 1 with one decimal below 10 and none above, or with --precision decimals,
+// dropping trailing zeros
+func formatUnits(value float64) string {
+	if precision >= 0 {
+		return roundTo(value, precision)
+	}
+	if math.Round(value*10) < 100 {
+		return strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%.0f", value)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import "testing"
+
+func TestFormatCPU(t *testing.T) {
+	tests := []struct {
+		cores float64
+		want  string
+	}{
+		{cores: 0, want: "0"},
+		{cores: -0.5, want: "0"},
+		{cores: 0.0004, want: "1m"},
+		{cores: 0.001, want: "1m"},
+		{cores: 0.234567, want: "235m"},
+		{cores: 0.9994, want: "999m"},
+		{cores: 0.9996, want: "1"},
+		{cores: 1, want: "1"},
+		{cores: 1.5, want: "1.5"},
+		{cores: 2.346, want: "2.35"},
+		{cores: 64, want: "64"},
+	}
+	for _, tt := range tests {
+		if got := formatCPU(tt.cores); got != tt.want {
+			t.Errorf("formatCPU(%g) = %s, want %s", tt.cores, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMemory(t *testing.T) {
+	tests := []struct {
+		bytes float64
+		want  string
+	}{
+		{bytes: 0, want: "0"},
+		{bytes: -1, want: "0"},
+		{bytes: 512, want: "512"},
+		{bytes: 1023, want: "1023"},
+		{bytes: kibibyte, want: "1Ki"},
+		{bytes: 512 * mebibyte, want: "512Mi"},
+		{bytes: gibibyte - mebibyte, want: "1023Mi"},
+		{bytes: gibibyte, want: "1Gi"},
+		{bytes: 2.3 * gibibyte, want: "2.3Gi"},
+		{bytes: 9.96 * gibibyte, want: "10Gi"},
+		{bytes: 100 * gibibyte, want: "100Gi"},
+		{bytes: tebibyte, want: "1Ti"},
+	}
+	for _, tt := range tests {
+		if got := formatMemory(tt.bytes); got != tt.want {
+			t.Errorf("formatMemory(%g) = %s, want %s", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestFormatWithPrecision(t *testing.T) {
+	saved := precision
+	t.Cleanup(func() { precision = saved })
+	precision = 3
+
+	if got := formatCPU(1.23456); got != "1.235" {
+		t.Errorf("formatCPU(1.23456) with --precision 3 = %s, want 1.235", got)
+	}
+	if got := formatMemory(2.3456 * gibibyte); got != "2.346Gi" {
+		t.Errorf("formatMemory(2.3456Gi) with --precision 3 = %s, want 2.346Gi", got)
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, injected at build time with -ldflags "-X github.com/pampatzoglou/k/cmd.Version=..."
+var (
+	Version = "dev"
+	Commit  = "none"
+	Date    = "unknown"
+)
+
+// versionInfo is the build metadata as rendered by the version command
+type versionInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+// versionCmd represents the version command
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version, git commit and build date",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := versionInfo{Version: Version, Commit: Commit, Date: Date}
+
+		switch outputFormat {
+		case "json":
+			return printJSON(info)
+		case "table":
+			fmt.Print(renderTable([]string{"VERSION", "COMMIT", "DATE"}, [][]string{{info.Version, info.Commit, info.Date}}))
+		default:
+			fmt.Printf("Version: %s\n", info.Version)
+			fmt.Printf("Commit:  %s\n", info.Commit)
+			fmt.Printf("Date:    %s\n", info.Date)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
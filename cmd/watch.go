@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchMode     bool          // Re-run the report every watchInterval until interrupted, set by --watch
+	watchInterval time.Duration // Time between two runs of the report, set by --interval
+	noClear       bool          // Keep the previous reports on screen instead of clearing it, set by --no-clear
+)
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// addWatchFlags registers the --watch, --interval and --no-clear flags on a command
+func addWatchFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&watchMode, "watch", false, "Re-run the report every --interval until interrupted")
+	cmd.Flags().DurationVar(&watchInterval, "interval", 30*time.Second, "Time between two runs of the report with --watch")
+	cmd.Flags().BoolVar(&noClear, "no-clear", false, "Don't clear the screen between two runs of the report with --watch, e.g. when logging to a file")
+}
+
+// validateWatch checks the --watch flags, which only make sense for reports read by a human
+func validateWatch() error {
+	if !watchMode {
+		return nil
+	}
+	if watchInterval <= 0 {
+		return fmt.Errorf("invalid interval %s: must be positive", watchInterval)
+	}
+	if outputFormat != "text" && outputFormat != "table" {
+		return fmt.Errorf("--watch is only supported with output formats text and table")
+	}
+	if outputFile != "" {
+		return fmt.Errorf("--watch can't be combined with --output-file, redirect stdout with --no-clear instead")
+	}
+	return nil
+}
+
+// runWatch runs report every watchInterval until the context is canceled. Errors of a run are printed and the next
+// run is attempted anyway, and exit statuses such as over-provisioning are ignored.
+func runWatch(ctx context.Context, report func() error) error {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for first := true; ; first = false {
+		if !noClear {
+			fmt.Print(clearScreen)
+		} else if !first {
+			fmt.Println()
+		}
+		// The report shows the instant it was evaluated at
+		fmt.Printf("Every %s\n\n", watchInterval)
+
+		// Every run must see fresh data
+		captureEvaluationInstant()
+		clearResponseCache()
+		staleWarningPrinted.Store(false)
+
+		var exitErr *exitError
+		if err := report(); err != nil && !errors.As(err, &exitErr) && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	analyzeSince, analyzeUntil string    // Raw values of --since and --until
+	windowStart, windowEnd     time.Time // Parsed window, zero unless --since is set
+)
+
+// cpuWindowUsage is the peak and average CPU usage of a namespace over the --since and --until window
+type cpuWindowUsage struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	Max   float64   `json:"max"` // Peak cores in use
+	Avg   float64   `json:"avg"` // Average cores in use
+}
+
+// parseAnalysisWindow parses --since and --until, which default to now, and checks that since is before until
+func parseAnalysisWindow(now time.Time) error {
+	if analyzeSince == "" {
+		if analyzeUntil != "" {
+			return fmt.Errorf("--until requires --since")
+		}
+		return nil
+	}
+	var err error
+	if windowStart, err = parseEvaluationTime(analyzeSince, now); err != nil {
+		return err
+	}
+	windowEnd = now
+	if analyzeUntil != "" {
+		if windowEnd, err = parseEvaluationTime(analyzeUntil, now); err != nil {
+			return err
+		}
+	}
+	if !windowStart.Before(windowEnd) {
+		return fmt.Errorf("invalid window: --since %s is not before --until %s", windowStart.Format(time.RFC3339), windowEnd.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// windowStep returns the resolution of the window range query: prometheus.step, coarsened to whole seconds when
+// the window would otherwise have more points than Prometheus allows
+func windowStep() time.Duration {
+	step := viper.GetDuration("prometheus.step")
+	if step <= 0 {
+		step = time.Minute
+	}
+	if minStep := windowEnd.Sub(windowStart) / (maxRangeQueryPoints - 1); step < minStep {
+		step = (minStep + time.Second - 1).Truncate(time.Second)
+	}
+	return step
+}
+
+// queryCPUWindowUsage returns the peak and average CPU usage of a namespace over the window, nil without data
+func queryCPUWindowUsage(ctx context.Context, namespace string) (*cpuWindowUsage, error) {
+	series, err := queryPrometheusRange(ctx, namespaceCPUUsageQuery(namespace), windowStart, windowEnd, windowStep())
+	if err != nil {
+		return nil, err
+	}
+	peak, avg, ok := maxAvgOverSeries(series)
+	if !ok {
+		return nil, nil
+	}
+	return &cpuWindowUsage{Since: windowStart.UTC(), Until: windowEnd.UTC(), Max: peak, Avg: avg}, nil
+}
+
+// maxAvgOverSeries returns the maximum and the average of the samples of all series.
+// The boolean is false when there are no samples.
+func maxAvgOverSeries(series []prometheusSeries) (peak, avg float64, ok bool) {
+	var sum float64
+	var count int
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			if count == 0 || sample.Value > peak {
+				peak = sample.Value
+			}
+			sum += sample.Value
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+	return peak, sum / float64(count), true
+}
+
+// describeWindow returns the window in report headings
+func describeWindow() string {
+	return fmt.Sprintf("from %s to %s", windowStart.UTC().Format(time.RFC3339), windowEnd.UTC().Format(time.RFC3339))
+}
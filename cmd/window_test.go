@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxAvgOverSeries(t *testing.T) {
+	tests := []struct {
+		name             string
+		series           []prometheusSeries
+		wantMax, wantAvg float64
+		wantOK           bool
+	}{
+		{name: "no series", series: nil},
+		{name: "series without samples", series: []prometheusSeries{seriesOf(), seriesOf()}},
+		{name: "single series", series: []prometheusSeries{seriesOf(1, 3, 2)}, wantMax: 3, wantAvg: 2, wantOK: true},
+		{
+			// The average is over all the samples, so the longer series weighs more
+			name:    "uneven sample counts",
+			series:  []prometheusSeries{seriesOf(4), seriesOf(1, 1, 1, 1, 2)},
+			wantMax: 4, wantAvg: 10.0 / 6, wantOK: true,
+		},
+		{name: "peak below zero", series: []prometheusSeries{seriesOf(-2, -1)}, wantMax: -1, wantAvg: -1.5, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peak, avg, ok := maxAvgOverSeries(tt.series)
+			if ok != tt.wantOK || peak != tt.wantMax || avg != tt.wantAvg {
+				t.Errorf("maxAvgOverSeries() = %g, %g, %t, want %g, %g, %t", peak, avg, ok, tt.wantMax, tt.wantAvg, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseAnalysisWindow(t *testing.T) {
+	savedSince, savedUntil, savedStart, savedEnd := analyzeSince, analyzeUntil, windowStart, windowEnd
+	t.Cleanup(func() {
+		analyzeSince, analyzeUntil, windowStart, windowEnd = savedSince, savedUntil, savedStart, savedEnd
+	})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name, since, until string
+		wantStart, wantEnd time.Time
+		wantErr            string
+	}{
+		{name: "no window"},
+		{name: "until without since", until: "-1h", wantErr: "--until requires --since"},
+		{name: "since until now", since: "-6h", wantStart: now.Add(-6 * time.Hour), wantEnd: now},
+		{
+			name:      "absolute window",
+			since:     "2024-05-01T10:00:00Z",
+			until:     "2024-05-01T11:00:00Z",
+			wantStart: now.Add(-2 * time.Hour), wantEnd: now.Add(-time.Hour),
+		},
+		{name: "since after until", since: "-1h", until: "-2h", wantErr: "is not before --until"},
+		{name: "since equal to until", since: "-1h", until: "-1h", wantErr: "is not before --until"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analyzeSince, analyzeUntil = tt.since, tt.until
+			windowStart, windowEnd = time.Time{}, time.Time{}
+			err := parseAnalysisWindow(now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !windowStart.Equal(tt.wantStart) || !windowEnd.Equal(tt.wantEnd) {
+				t.Errorf("window = %s to %s, want %s to %s", windowStart, windowEnd, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}